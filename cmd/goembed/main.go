@@ -0,0 +1,338 @@
+// Command goembed inspects the go:embed vars of packages.
+//
+// Usage:
+//
+//	goembed list [flags] [packages]
+//	goembed files [flags] [packages]
+//	goembed check [flags] [packages]
+//
+// The list command prints the go:embed vars with their kinds, patterns
+// and positions, without reading the embedded files. The files command
+// prints the files embedded by each var with their sizes and hashes.
+// The check command reports all errors of the go:embed vars and exits
+// with status 1 if there are any.
+//
+// The packages are import paths or directories, and default to the
+// package in the current directory. A relative path of an existing
+// directory is a directory.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/build"
+	"go/printer"
+	"go/scanner"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/visualfc/goembed"
+)
+
+const usage = `usage: goembed <command> [flags] [packages]
+
+The commands are:
+
+	list    print the go:embed vars
+	files   print the embedded files
+	check   check the go:embed vars
+
+The flags are:
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the goembed command line args and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("goembed", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	jsonFlag := flags.Bool("json", false, "print JSON output")
+	testFlag := flags.Bool("test", false, "include the test files")
+	tagsFlag := flags.String("tags", "", "comma-separated list of additional build tags")
+	hashFlag := flags.String("hash", "sha256", "hash of the files: sha256, toolchain or none")
+	goFlag := flags.String("go", "", "target Go version, like the go directive of go.mod, default the go directive of the package module")
+	if len(args) == 0 {
+		flags.Usage()
+		return 2
+	}
+	cmd := args[0]
+	if cmd != "list" && cmd != "files" && cmd != "check" {
+		fmt.Fprintf(stderr, "goembed: unknown command %q\n", cmd)
+		flags.Usage()
+		return 2
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	var hash goembed.HashKind
+	switch *hashFlag {
+	case "sha256":
+		hash = goembed.HashSHA256
+	case "toolchain":
+		var err error
+		if hash, err = goembed.ToolchainHash(*goFlag); err != nil {
+			fmt.Fprintf(stderr, "goembed: %v\n", err)
+			return 2
+		}
+	case "none":
+		hash = goembed.HashNone
+	default:
+		fmt.Fprintf(stderr, "goembed: invalid hash %q\n", *hashFlag)
+		return 2
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	var tags []string
+	if *tagsFlag != "" {
+		tags = strings.Split(*tagsFlag, ",")
+	}
+	c := &command{
+		stdout: stdout,
+		stderr: stderr,
+		json:   *jsonFlag,
+		opts: &goembed.LoadOptions{
+			Tests:         *testFlag,
+			XTests:        *testFlag,
+			BuildTags:     tags,
+			AllErrors:     cmd == "check",
+			EmbedsOnly:    cmd == "list",
+			TargetVersion: *goFlag,
+		},
+		hash: hash,
+	}
+	switch cmd {
+	case "list":
+		return c.list(paths)
+	case "files":
+		return c.files(paths)
+	default:
+		return c.check(paths)
+	}
+}
+
+type command struct {
+	stdout io.Writer
+	stderr io.Writer
+	json   bool
+	opts   *goembed.LoadOptions
+	hash   goembed.HashKind
+}
+
+// load loads the package path
+func (c *command) load(path string) (*goembed.Package, error) {
+	dir, err := packageDir(path, c.opts.BuildTags)
+	if err != nil {
+		return nil, err
+	}
+	opts := *c.opts
+	if opts.TargetVersion == "" {
+		opts.TargetVersion = goembed.ModuleGoVersion(dir)
+	}
+	rs := []goembed.ResolveOption{goembed.WithLazy()}
+	if opts.TargetVersion != "" {
+		rs = append(rs, goembed.WithTargetVersion(opts.TargetVersion))
+	}
+	rs = append(rs, goembed.WithHash(c.hash))
+	if opts.AllErrors {
+		rs = append(rs, goembed.WithAllErrors())
+	}
+	opts.Resolve = goembed.NewResolve(rs...)
+	return goembed.LoadPackage(dir, &opts)
+}
+
+// packageDir returns the directory of the package path
+func packageDir(path string, tags []string) (string, error) {
+	if build.IsLocalImport(path) || filepath.IsAbs(path) {
+		return path, nil
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return path, nil
+	}
+	ctxt := build.Default
+	ctxt.BuildTags = append(append([]string(nil), ctxt.BuildTags...), tags...)
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	bp, err := ctxt.Import(path, wd, build.FindOnly)
+	if err != nil {
+		return "", err
+	}
+	return bp.Dir, nil
+}
+
+// Var is the JSON output of a go:embed var
+type Var struct {
+	Package  string
+	Name     string
+	Kind     string
+	Type     string
+	Pos      string
+	Patterns []Pattern
+}
+
+// Pattern is the JSON output of a go:embed pattern
+type Pattern struct {
+	Pattern string
+	Pos     string
+}
+
+// File is the JSON output of an embedded file
+type File struct {
+	Package string
+	Var     string
+	Name    string
+	Size    int64
+	Hash    string
+}
+
+// Error is the JSON output of an error
+type Error struct {
+	Package string
+	Pos     string `json:",omitempty"`
+	Err     string
+}
+
+func (c *command) list(paths []string) int {
+	vars := []*Var{}
+	for _, path := range paths {
+		pkg, err := c.load(path)
+		if err != nil {
+			fmt.Fprintln(c.stderr, err)
+			return 1
+		}
+		for _, em := range pkg.Embeds {
+			v := &Var{
+				Package: pkg.ImportPath,
+				Name:    em.Name,
+				Kind:    em.Kind.String(),
+				Type:    typeString(pkg, em),
+				Pos:     pkg.Fset.Position(em.Spec.Names[0].Pos()).String(),
+			}
+			for i, pattern := range em.Patterns {
+				var pos string
+				if i < len(em.PatternPos) {
+					pos = posString(em.PatternPos[i])
+				}
+				v.Patterns = append(v.Patterns, Pattern{pattern, pos})
+			}
+			vars = append(vars, v)
+		}
+	}
+	if c.json {
+		return c.writeJSON(vars)
+	}
+	for _, v := range vars {
+		var patterns []string
+		for _, p := range v.Patterns {
+			patterns = append(patterns, p.Pattern)
+		}
+		fmt.Fprintf(c.stdout, "%s: %s %s %s %s\n", v.Pos, v.Name, v.Type, v.Kind, strings.Join(patterns, " "))
+	}
+	return 0
+}
+
+func (c *command) files(paths []string) int {
+	files := []*File{}
+	for _, path := range paths {
+		pkg, err := c.load(path)
+		if err != nil {
+			fmt.Fprintln(c.stderr, err)
+			return 1
+		}
+		for _, em := range pkg.Embeds {
+			for _, f := range pkg.EmbedFiles[em] {
+				files = append(files, &File{
+					Package: pkg.ImportPath,
+					Var:     em.Name,
+					Name:    f.Name,
+					Size:    f.Size,
+					Hash:    fmt.Sprintf("%x", f.Hash),
+				})
+			}
+		}
+	}
+	if c.json {
+		return c.writeJSON(files)
+	}
+	for _, f := range files {
+		fmt.Fprintf(c.stdout, "%s %s %d %s\n", f.Var, f.Name, f.Size, f.Hash)
+	}
+	return 0
+}
+
+func (c *command) check(paths []string) int {
+	errs := []*Error{}
+	for _, path := range paths {
+		pkg, err := c.load(path)
+		if pkg != nil {
+			path = pkg.ImportPath
+		}
+		switch err := err.(type) {
+		case nil:
+		case scanner.ErrorList:
+			for _, e := range err {
+				errs = append(errs, &Error{Package: path, Pos: posString(e.Pos), Err: e.Msg})
+			}
+		case *scanner.Error:
+			errs = append(errs, &Error{Package: path, Pos: posString(err.Pos), Err: err.Msg})
+		default:
+			errs = append(errs, &Error{Package: path, Err: err.Error()})
+		}
+	}
+	if c.json {
+		if code := c.writeJSON(errs); code != 0 {
+			return code
+		}
+	} else {
+		for _, e := range errs {
+			if e.Pos != "" {
+				fmt.Fprintf(c.stderr, "%s: %s\n", e.Pos, e.Err)
+			} else {
+				fmt.Fprintln(c.stderr, e.Err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (c *command) writeJSON(v interface{}) int {
+	data, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return 1
+	}
+	c.stdout.Write(append(data, '\n'))
+	return 0
+}
+
+// typeString returns the type expression of em
+func typeString(pkg *goembed.Package, em *goembed.Embed) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, pkg.Fset, em.Spec.Type)
+	return buf.String()
+}
+
+// posString returns pos as a string, or empty if pos is invalid
+func posString(pos token.Position) string {
+	if !pos.IsValid() {
+		return ""
+	}
+	return pos.String()
+}
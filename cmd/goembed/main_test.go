@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"list", "-test", "-json", "../.."}, &stdout, &stderr); code != 0 {
+		t.Fatalf("list error: %v %v", code, stderr.String())
+	}
+	var vars []*Var
+	if err := json.Unmarshal(stdout.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+	var info []string
+	for _, v := range vars {
+		info = append(info, v.Name+" "+v.Kind+" "+v.Type+" "+v.Patterns[0].Pattern)
+	}
+	want := []string{
+		"data1 string string testdata/data1.txt",
+		"data2 bytes []byte testdata/data2.txt",
+		"fs files embed.FS testdata",
+		"hashfs files embed.FS testdata/_hash",
+	}
+	if strings.Join(info, ";") != strings.Join(want, ";") {
+		t.Fatalf("list error: %v", info)
+	}
+	if !strings.HasSuffix(vars[0].Patterns[0].Pos, "embed_test.go:26:12") {
+		t.Fatalf("list pos error: %v", vars[0].Patterns[0].Pos)
+	}
+}
+
+func TestListNoFiles(t *testing.T) {
+	dir := t.TempDir()
+	src := `package main
+
+import _ "embed"
+
+//go:embed missing.txt
+var missing string
+
+func main() {
+}
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"list", dir}, &stdout, &stderr); code != 0 {
+		t.Fatalf("list error: %v %v", code, stderr.String())
+	}
+	want := filepath.Join(dir, "main.go") + ":6:5: missing string string missing.txt\n"
+	if stdout.String() != want {
+		t.Fatalf("list error:\n%v\nwant\n%v", stdout.String(), want)
+	}
+}
+
+func TestDirPackage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"list", "-json", "testdata/pkg"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("list error: %v %v", code, stderr.String())
+	}
+	var vars []*Var
+	if err := json.Unmarshal(stdout.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+	if len(vars) != 2 || vars[0].Name != "data" || vars[1].Name != "missing" {
+		t.Fatalf("list dir error: %v", stdout.String())
+	}
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"check", "-json", "testdata/pkg"}, &stdout, &stderr); code != 1 {
+		t.Fatalf("check error: %v %v", code, stderr.String())
+	}
+	var errs []*Error
+	if err := json.Unmarshal(stdout.Bytes(), &errs); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Package != vars[0].Package || errs[0].Err != "pattern missing.txt: no matching files found" {
+		t.Fatalf("check dir error: %v", stdout.String())
+	}
+}
+
+func TestFiles(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"files", "-test", "../.."}, &stdout, &stderr); code != 0 {
+		t.Fatalf("files error: %v %v", code, stderr.String())
+	}
+	lines := strings.Split(stdout.String(), "\n")
+	if lines[0] != "data1 testdata/data1.txt 11 6b14bb74fb7b3acf2f16dce88cfc6e22" {
+		t.Fatalf("files error: %v", lines[0])
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	src := `package main
+
+import _ "embed"
+
+//go:embed data.txt
+var data string
+
+//go:embed missing.txt
+var missing string
+
+//go:embed data.txt
+var bad struct{}
+
+func main() {
+}
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "data.txt"), []byte("data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"check", dir}, &stdout, &stderr); code != 1 {
+		t.Fatalf("check error: %v %v", code, stderr.String())
+	}
+	fname := filepath.Join(dir, "main.go")
+	want := fname + ":8:12: pattern missing.txt: no matching files found\n" +
+		fname + ":12:5: go:embed cannot apply to var of type struct{}\n"
+	if stderr.String() != want {
+		t.Fatalf("check error:\n%v\nwant\n%v", stderr.String(), want)
+	}
+	if err := os.Remove(fname); err != nil {
+		t.Fatal(err)
+	}
+	src = strings.Replace(src, "missing.txt", "data.txt", 1)
+	src = strings.Replace(src, "var bad struct{}", "var bad []byte", 1)
+	if err := ioutil.WriteFile(fname, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"check", "-json", dir}, &stdout, &stderr); code != 0 {
+		t.Fatalf("check error: %v %v %v", code, stdout.String(), stderr.String())
+	}
+	if strings.TrimSpace(stdout.String()) != "[]" {
+		t.Fatalf("check json error: %v", stdout.String())
+	}
+}
+
+func TestUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"bogus"}, &stdout, &stderr); code != 2 {
+		t.Fatalf("usage error: %v", code)
+	}
+	if !strings.Contains(stderr.String(), `unknown command "bogus"`) {
+		t.Fatalf("usage error: %v", stderr.String())
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+import _ "embed"
+
+//go:embed data.txt
+var data string
+
+//go:embed missing.txt
+var missing string
+
+func main() {
+}
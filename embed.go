@@ -2,14 +2,19 @@ package goembed
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/printer"
+	"go/scanner"
 	"go/token"
+	"go/types"
 	"sort"
 	"strings"
 
+	"github.com/visualfc/goembed/internal/goversion"
 	embedparser "github.com/visualfc/goembed/parser"
+	"github.com/visualfc/goembed/resolve"
 )
 
 // Kind is embed var type kind
@@ -23,13 +28,30 @@ const (
 	EmbedMaybeAlias // may be alias string or []byte
 )
 
+func (k Kind) String() string {
+	switch k {
+	case EmbedUnknown:
+		return "unknown"
+	case EmbedBytes:
+		return "bytes"
+	case EmbedString:
+		return "string"
+	case EmbedFiles:
+		return "files"
+	case EmbedMaybeAlias:
+		return "maybe-alias"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
 // Embed describes go:embed variable
 type Embed struct {
-	Name     string
-	Kind     Kind
-	Patterns []string
-	Pos      token.Position
-	Spec     *ast.ValueSpec
+	Name       string
+	Kind       Kind
+	Patterns   []string
+	PatternPos []token.Position // position of each pattern
+	Pos        token.Position
+	Spec       *ast.ValueSpec
 }
 
 // embedPos is go:embed start postion
@@ -39,13 +61,85 @@ func (e *Embed) embedPos() (pos token.Position) {
 	return
 }
 
+// firstEmbedPos is the first go:embed start position
+func (e *Embed) firstEmbedPos() (pos token.Position) {
+	if len(e.PatternPos) == 0 {
+		return e.embedPos()
+	}
+	pos = e.PatternPos[0]
+	pos.Column -= 9
+	return
+}
+
+// patternError sets the position of the failing pattern to the
+// resolve errors in err, or else prefixes err with e.Pos.
+func (e *Embed) patternError(err error) error {
+	if list, ok := err.(resolve.ErrorList); ok {
+		for _, perr := range list {
+			if !e.setPatternPos(perr) {
+				perr.Pos = e.Pos
+			}
+		}
+		return list
+	}
+	var perr *resolve.EmbedError
+	if errors.As(err, &perr) && e.setPatternPos(perr) {
+		return err
+	}
+	return fmt.Errorf("%v: %w", e.Pos, err)
+}
+
+func (e *Embed) setPatternPos(perr *resolve.EmbedError) bool {
+	for i, pattern := range e.Patterns {
+		if pattern == perr.Pattern && i < len(e.PatternPos) {
+			perr.Pos = e.PatternPos[i]
+			return true
+		}
+	}
+	return false
+}
+
 type embedPattern struct {
 	Patterns string
 	Pos      token.Position
 }
 
+// Config is the configuration for checking go:embed vars
+type Config struct {
+	// AllErrors reports all errors as a scanner.ErrorList sorted by
+	// position instead of only the first one, and returns the valid
+	// go:embed vars together with the errors.
+	AllErrors bool
+
+	// Info, if set, is the type information of the checked files.
+	// The kind of a go:embed var is then resolved from the type
+	// recorded in Info.Defs, following the compiler rules for
+	// aliases and defined types, instead of EmbedMaybeAlias.
+	Info *types.Info
+
+	// TargetVersion is the Go version the go:embed vars are checked
+	// for, like the go directive of go.mod ("1.16" or "go1.16").
+	// Empty is any version. go:embed vars are errors before go1.16,
+	// and before go1.17 their type must be written as string, []byte
+	// or embed.FS, not as an alias or defined type.
+	TargetVersion string
+}
+
 // CheckEmbed lookup go:embed vars for embedPatternPos
 func CheckEmbed(embedPatternPos map[string][]token.Position, fset *token.FileSet, files []*ast.File) ([]*Embed, error) {
+	var conf Config
+	return conf.CheckEmbed(embedPatternPos, fset, files)
+}
+
+// CheckEmbed lookup go:embed vars for embedPatternPos with the configuration
+func (conf *Config) CheckEmbed(embedPatternPos map[string][]token.Position, fset *token.FileSet, files []*ast.File) ([]*Embed, error) {
+	minor := -1
+	if conf.TargetVersion != "" {
+		var ok bool
+		if minor, ok = goversion.Minor(conf.TargetVersion); !ok {
+			return nil, fmt.Errorf("invalid go version %q", conf.TargetVersion)
+		}
+	}
 	if len(embedPatternPos) == 0 {
 		return nil, nil
 	}
@@ -65,33 +159,69 @@ func CheckEmbed(embedPatternPos map[string][]token.Position, fset *token.FileSet
 		return n < 0
 	})
 	var eps []*Embed
-	last := &Embed{Patterns: []string{ep[0].Patterns}, Pos: ep[0].Pos}
+	last := &Embed{Patterns: []string{ep[0].Patterns}, PatternPos: []token.Position{ep[0].Pos}, Pos: ep[0].Pos}
 	eps = append(eps, last)
 	for i := 1; i < len(ep); i++ {
 		e := ep[i]
 		if e.Pos.Filename == last.Pos.Filename &&
 			(e.Pos.Line == last.Pos.Line || e.Pos.Line == last.Pos.Line+1) {
 			last.Patterns = append(last.Patterns, e.Patterns)
+			last.PatternPos = append(last.PatternPos, e.Pos)
 			last.Pos = e.Pos
 		} else {
-			last = &Embed{Patterns: []string{e.Patterns}, Pos: e.Pos}
+			last = &Embed{Patterns: []string{e.Patterns}, PatternPos: []token.Position{e.Pos}, Pos: e.Pos}
 			eps = append(eps, last)
 		}
 	}
+	c := &checker{fset: fset, info: conf.Info, minor: minor, bad: make(map[*Embed]bool)}
 	for _, file := range files {
 		if fmap[fset.Position(file.Package).Filename] {
-			err := findEmbed(fset, file, eps)
+			err := c.findEmbed(file, eps)
 			if err != nil {
-				return nil, err
+				if !conf.AllErrors {
+					return nil, err
+				}
+				c.errs.Add(fset.Position(file.Package), err.Error())
 			}
 		}
 	}
+	var list []*Embed
 	for _, e := range eps {
+		if c.bad[e] {
+			continue
+		}
 		if e.Spec == nil {
-			return nil, fmt.Errorf("%v: misplaced go:embed directive", e.embedPos())
+			c.errorf(e, e.embedPos(), "misplaced go:embed directive")
+			continue
+		}
+		if minor >= 0 && minor < 16 {
+			c.errorf(e, e.firstEmbedPos(), "go:embed requires go1.16 or later (-lang was set to go1.%d; check go.mod)", minor)
+			continue
 		}
+		list = append(list, e)
 	}
-	return eps, nil
+	if len(c.errs) > 0 {
+		c.errs.Sort()
+		if !conf.AllErrors {
+			return nil, c.errs[0]
+		}
+		return list, c.errs
+	}
+	return list, nil
+}
+
+// checker collects the errors of go:embed vars
+type checker struct {
+	fset  *token.FileSet
+	info  *types.Info
+	minor int // minor version of the target version, -1 is any
+	errs  scanner.ErrorList
+	bad   map[*Embed]bool
+}
+
+func (c *checker) errorf(e *Embed, pos token.Position, format string, args ...interface{}) {
+	c.bad[e] = true
+	c.errs.Add(pos, fmt.Sprintf(format, args...))
 }
 
 func checkIdent(v ast.Expr, name string) bool {
@@ -101,7 +231,21 @@ func checkIdent(v ast.Expr, name string) bool {
 	return false
 }
 
-func embedKind(typ ast.Expr, importName string) Kind {
+// aliasMinor is the minor version from which the type of a go:embed
+// var may be an alias or defined type
+const aliasMinor = 17
+
+// isStrict reports whether the type of a go:embed var must be written
+// as string, []byte or embed.FS for the minor version. Before go1.16
+// go:embed vars are errors anyway.
+func isStrict(minor int) bool {
+	return minor >= 16 && minor < aliasMinor
+}
+
+// embedKind returns the kind of the type expression typ for the minor
+// version, -1 is any. A type that may be an alias is EmbedMaybeAlias,
+// or EmbedUnknown before go1.17.
+func embedKind(typ ast.Expr, importName string, minor int) Kind {
 	switch v := typ.(type) {
 	case *ast.Ident:
 		switch v.Name {
@@ -112,7 +256,9 @@ func embedKind(typ ast.Expr, importName string) Kind {
 				return EmbedFiles
 			}
 		}
-		return EmbedMaybeAlias
+		if !isStrict(minor) {
+			return EmbedMaybeAlias
+		}
 	case *ast.ArrayType:
 		if v.Len != nil {
 			break
@@ -121,7 +267,9 @@ func embedKind(typ ast.Expr, importName string) Kind {
 			if ident.Name == "byte" {
 				return EmbedBytes
 			}
-			return EmbedMaybeAlias
+			if !isStrict(minor) {
+				return EmbedMaybeAlias
+			}
 		}
 	case *ast.SelectorExpr:
 		if checkIdent(v.X, importName) && checkIdent(v.Sel, "FS") {
@@ -131,42 +279,231 @@ func embedKind(typ ast.Expr, importName string) Kind {
 	return EmbedUnknown
 }
 
-func findEmbed(fset *token.FileSet, file *ast.File, eps []*Embed) error {
+// embedKind returns the kind of the go:embed var name for the minor
+// version, using the type information if available.
+func (c *checker) embedKind(name *ast.Ident, typ ast.Expr, importName string, minor int) Kind {
+	if c.info != nil {
+		if obj := c.info.Defs[name]; obj != nil && obj.Type() != types.Typ[types.Invalid] {
+			kind := typesEmbedKind(obj.Type(), minor)
+			if isStrict(minor) && embedKind(typ, importName, minor) != kind {
+				// the type is not written as string, []byte or embed.FS
+				return EmbedUnknown
+			}
+			return kind
+		}
+	}
+	return embedKind(typ, importName, minor)
+}
+
+// typesEmbedKind returns the kind of typ the way the compiler does:
+// embed.FS or an alias of it, any string type, or any slice type
+// with a byte element. Before go1.17, typ must be embed.FS, string
+// or []byte itself.
+func typesEmbedKind(typ types.Type, minor int) Kind {
+	if isStrict(minor) {
+		switch t := typ.(type) {
+		case *types.Named:
+			if obj := t.Obj(); obj.Name() == "FS" && obj.Pkg() != nil && obj.Pkg().Path() == "embed" {
+				return EmbedFiles
+			}
+		case *types.Basic:
+			if t.Kind() == types.String {
+				return EmbedString
+			}
+		case *types.Slice:
+			if elem, ok := t.Elem().(*types.Basic); ok && elem.Kind() == types.Uint8 {
+				return EmbedBytes
+			}
+		}
+		return EmbedUnknown
+	}
+	if named, ok := unalias(typ).(*types.Named); ok {
+		obj := named.Obj()
+		if obj.Name() == "FS" && obj.Pkg() != nil && obj.Pkg().Path() == "embed" {
+			return EmbedFiles
+		}
+	}
+	switch t := typ.Underlying().(type) {
+	case *types.Basic:
+		if t.Info()&types.IsString != 0 {
+			return EmbedString
+		}
+	case *types.Slice:
+		if elem, ok := t.Elem().Underlying().(*types.Basic); ok && elem.Kind() == types.Uint8 {
+			return EmbedBytes
+		}
+	}
+	return EmbedUnknown
+}
+
+// embedTarget is a node of a file that a go:embed directive may precede
+type embedTarget struct {
+	offset int
+	end    bool           // offset is the end of a node
+	spec   *ast.ValueSpec // var spec declared by the node, if any
+	inFunc bool           // node is inside a function body
+}
+
+// embedTargets returns the targets of file sorted by offset. Ends of
+// nodes are targets too, so that a directive at the end of a block or
+// of a grouped declaration does not apply to a node after it.
+func (c *checker) embedTargets(file *ast.File) []*embedTarget {
+	var targets []*embedTarget
+	var stack []ast.Node
+	funcs := 0
+	varSpecs := make(map[*ast.ValueSpec]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			n = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if _, ok := n.(*ast.BlockStmt); ok && isFuncBody(stack) {
+				funcs--
+			}
+			return true
+		}
+		switch n.(type) {
+		case *ast.CommentGroup, *ast.Comment:
+			return false
+		}
+		t := &embedTarget{offset: c.fset.Position(n.Pos()).Offset, inFunc: funcs > 0}
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			if isFuncBody(stack) {
+				funcs++
+			}
+		case *ast.DeclStmt:
+			if d, ok := n.Decl.(*ast.GenDecl); ok {
+				t.spec = varSpec(d, varSpecs)
+			}
+		case *ast.GenDecl:
+			t.spec = varSpec(n, varSpecs)
+		case *ast.ValueSpec:
+			if varSpecs[n] {
+				t.spec = n
+			}
+		}
+		stack = append(stack, n)
+		targets = append(targets, t,
+			&embedTarget{offset: c.fset.Position(n.End()).Offset, end: true})
+		return true
+	})
+	sort.SliceStable(targets, func(i, j int) bool {
+		if targets[i].offset == targets[j].offset {
+			return !targets[i].end && targets[j].end
+		}
+		return targets[i].offset < targets[j].offset
+	})
+	return targets
+}
+
+// isFuncBody reports whether a block with the parents stack is the body
+// of a function declaration or literal.
+func isFuncBody(stack []ast.Node) bool {
+	if len(stack) == 0 {
+		return false
+	}
+	switch stack[len(stack)-1].(type) {
+	case *ast.FuncDecl, *ast.FuncLit:
+		return true
+	}
+	return false
+}
+
+// varSpec returns the var spec declared by the ungrouped var decl d,
+// and records the specs of a grouped var decl in varSpecs.
+func varSpec(d *ast.GenDecl, varSpecs map[*ast.ValueSpec]bool) *ast.ValueSpec {
+	if d.Tok != token.VAR {
+		return nil
+	}
+	if d.Lparen.IsValid() {
+		for _, spec := range d.Specs {
+			if vs, ok := spec.(*ast.ValueSpec); ok {
+				varSpecs[vs] = true
+			}
+		}
+		return nil
+	}
+	if len(d.Specs) == 1 {
+		if vs, ok := d.Specs[0].(*ast.ValueSpec); ok {
+			return vs
+		}
+	}
+	return nil
+}
+
+// findEmbed applies the go:embed directives of file to the var specs
+// following them. Like the compiler, blank lines and comments may
+// separate a directive from its var, and consecutive directives of
+// the same var are merged.
+func (c *checker) findEmbed(file *ast.File, eps []*Embed) error {
+	filename := c.fset.Position(file.Package).Filename
 	importName, err := embedparser.FindEmbedImportName(file)
 	if err != nil {
+		for _, e := range eps {
+			if e.Pos.Filename == filename {
+				c.bad[e] = true
+			}
+		}
 		return err
 	}
-	for _, decl := range file.Decls {
-		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.VAR {
-			for _, spec := range d.Specs {
-				vs, ok := spec.(*ast.ValueSpec)
-				if !ok {
-					continue
-				}
-				name := vs.Names[0]
-				pos := fset.Position(name.NamePos)
-				for _, e := range eps {
-					if pos.Filename == e.Pos.Filename &&
-						pos.Line == e.Pos.Line+1 {
-						if len(vs.Names) != 1 {
-							return fmt.Errorf("%v: go:embed cannot apply to multiple vars", e.embedPos())
-						}
-						if len(vs.Values) > 0 {
-							return fmt.Errorf("%v: go:embed cannot apply to var with initializer", e.embedPos())
-						}
-						kind := embedKind(vs.Type, importName)
-						if kind == EmbedUnknown {
-							var buf bytes.Buffer
-							printer.Fprint(&buf, fset, vs.Type)
-							return fmt.Errorf("%v: go:embed cannot apply to var of type %v", pos, buf.String())
-						}
-						e.Name = name.Name
-						e.Kind = kind
-						e.Spec = vs
-					}
-				}
+	targets := c.embedTargets(file)
+	specs := make(map[*ast.ValueSpec]*Embed)
+	inFunc := make(map[*Embed]bool)
+	for _, e := range eps {
+		if e.Pos.Filename != filename {
+			continue
+		}
+		i := sort.Search(len(targets), func(i int) bool {
+			return targets[i].offset > e.Pos.Offset
+		})
+		if i == len(targets) || targets[i].spec == nil {
+			continue
+		}
+		t := targets[i]
+		if first, ok := specs[t.spec]; ok {
+			first.Patterns = append(first.Patterns, e.Patterns...)
+			first.PatternPos = append(first.PatternPos, e.PatternPos...)
+			first.Pos = e.Pos
+			c.bad[e] = true
+			continue
+		}
+		specs[t.spec] = e
+		inFunc[e] = t.inFunc
+		e.Spec = t.spec
+	}
+	for _, e := range eps {
+		vs := e.Spec
+		if vs == nil || c.bad[e] || e.Pos.Filename != filename {
+			continue
+		}
+		e.Spec = nil
+		if len(vs.Names) != 1 {
+			c.errorf(e, e.firstEmbedPos(), "go:embed cannot apply to multiple vars")
+			continue
+		}
+		if len(vs.Values) > 0 {
+			c.errorf(e, e.firstEmbedPos(), "go:embed cannot apply to var with initializer")
+			continue
+		}
+		if inFunc[e] {
+			c.errorf(e, e.firstEmbedPos(), "go:embed cannot apply to var inside func")
+			continue
+		}
+		name := vs.Names[0]
+		kind := c.embedKind(name, vs.Type, importName, c.minor)
+		if kind == EmbedUnknown {
+			var buf bytes.Buffer
+			printer.Fprint(&buf, c.fset, vs.Type)
+			if isStrict(c.minor) && c.embedKind(name, vs.Type, importName, -1) != EmbedUnknown {
+				c.errorf(e, c.fset.Position(name.NamePos), "go:embed var of type %v requires go1.%d or later (-lang was set to go1.%d; check go.mod)", buf.String(), aliasMinor, c.minor)
+				continue
 			}
+			c.errorf(e, c.fset.Position(name.NamePos), "go:embed cannot apply to var of type %v", buf.String())
+			continue
 		}
+		e.Name = name.Name
+		e.Kind = kind
+		e.Spec = vs
 	}
 	return nil
 }
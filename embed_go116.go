@@ -0,0 +1,72 @@
+//go:build go1.16
+// +build go1.16
+
+package goembed
+
+import (
+	"embed"
+	"errors"
+	"reflect"
+	"unsafe"
+)
+
+// embedFS is the layout of embed.FS known to the compiler,
+// see cmd/compile/internal/staticdata's WriteEmbed.
+// It is the same from go1.16 to the current release.
+type embedFS struct {
+	files *[]embedFile
+}
+
+type embedFile struct {
+	name string
+	data string
+	hash [16]byte
+}
+
+var errEmbedLayout = checkEmbedLayout(reflect.TypeOf(embed.FS{}))
+
+// checkEmbedLayout checks that typ has the layout of embedFS.
+func checkEmbedLayout(typ reflect.Type) error {
+	err := errors.New("goembed: unknown embed.FS layout")
+	want := reflect.TypeOf(embedFS{})
+	if typ.Kind() != reflect.Struct || typ.NumField() != want.NumField() || typ.Size() != want.Size() {
+		return err
+	}
+	files := typ.Field(0)
+	if files.Name != "files" || files.Type.Kind() != reflect.Ptr || files.Type.Elem().Kind() != reflect.Slice {
+		return err
+	}
+	typ = files.Type.Elem().Elem()
+	want = reflect.TypeOf(embedFile{})
+	if typ.Kind() != reflect.Struct || typ.NumField() != want.NumField() || typ.Size() != want.Size() {
+		return err
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		f, w := typ.Field(i), want.Field(i)
+		if f.Name != w.Name || f.Offset != w.Offset || f.Type != w.Type {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewEmbedFS returns a genuine embed.FS of files, adding the directories
+// by BuildFS, for interpreters running code with go:embed embed.FS vars.
+// It returns an error if the running Go release has an unknown embed.FS layout.
+func NewEmbedFS(files []*File) (embed.FS, error) {
+	var fs embed.FS
+	if errEmbedLayout != nil {
+		return fs, errEmbedLayout
+	}
+	list := BuildFS(files)
+	efiles := make([]embedFile, len(list))
+	for i, f := range list {
+		data, err := f.ReadData()
+		if err != nil {
+			return fs, err
+		}
+		efiles[i] = embedFile{name: f.Name, data: string(data), hash: f.Hash}
+	}
+	(*embedFS)(unsafe.Pointer(&fs)).files = &efiles
+	return fs, nil
+}
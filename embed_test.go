@@ -5,15 +5,21 @@ package goembed
 
 import (
 	"embed"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/build"
+	"go/importer"
 	"go/parser"
 	"go/token"
+	"go/types"
+	iofs "io/fs"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"unsafe"
 )
 
@@ -26,6 +32,9 @@ var (
 
 	//go:embed testdata
 	fs embed.FS
+
+	//go:embed testdata/_hash
+	hashfs embed.FS
 )
 
 type file struct {
@@ -69,7 +78,11 @@ func TestResolve(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	r := NewResolve()
+	hash, err := ToolchainHash("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewResolve(WithHash(hash))
 	var checkData1 bool
 	var checkData2 bool
 	var checkFS bool
@@ -98,22 +111,11 @@ func TestResolve(t *testing.T) {
 			var info1 []string
 			var info2 []string
 			mfiles := *(*myfs)(unsafe.Pointer(&fs)).files
-			switch runtime.Version()[:6] {
-			default:
-				for _, file := range mfiles {
-					info1 = append(info1, fmt.Sprintf("%v,%v,%v", file.name, file.data, file.hash))
-				}
-				for _, f := range files {
-					info2 = append(info2, fmt.Sprintf("%v,%v,%v", f.Name, string(f.Data), f.Hash))
-				}
-			case "go1.19":
-				t.Log("go1.19 compiler use NOTSHA256 skip hash check")
-				for _, file := range mfiles {
-					info1 = append(info1, fmt.Sprintf("%v,%v", file.name, file.data))
-				}
-				for _, f := range files {
-					info2 = append(info2, fmt.Sprintf("%v,%v", f.Name, string(f.Data)))
-				}
+			for _, file := range mfiles {
+				info1 = append(info1, fmt.Sprintf("%v,%v,%v", file.name, file.data, file.hash))
+			}
+			for _, f := range files {
+				info2 = append(info2, fmt.Sprintf("%v,%v,%v", f.Name, string(f.Data), f.Hash))
 			}
 			if strings.Join(info1, ";") != strings.Join(info2, ";") {
 				t.Fatalf("build fs error:\n%v\n%v", info1, info2)
@@ -146,3 +148,269 @@ func TestBytesList(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func fsInfo(t *testing.T, fsys iofs.FS) (info []string) {
+	err := iofs.WalkDir(fsys, ".", func(path string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, _ := iofs.ReadFile(fsys, path)
+		info = append(info, fmt.Sprintf("%v,%v,%v,%v,%v", path, fi.Mode(), fi.Size(), fi.ModTime(), string(data)))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func loadFS(t *testing.T) []*File {
+	pkg, err := build.Import("github.com/visualfc/goembed", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, "embed_test.go"), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ems, err := CheckEmbed(pkg.TestEmbedPatternPos, fset, []*ast.File{f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []*File
+	for _, em := range ems {
+		if em.Name == "fs" {
+			files, err = NewResolve().Load(pkg.Dir, fset, em)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return files
+}
+
+func TestFS(t *testing.T) {
+	fsys := NewFS(loadFS(t))
+	if err := fstest.TestFS(fsys, "testdata/data1.txt", "testdata/one/data.txt", "testdata/two/data2.txt"); err != nil {
+		t.Fatal(err)
+	}
+	info1 := fsInfo(t, fs)
+	info2 := fsInfo(t, fsys)
+	if strings.Join(info1, ";") != strings.Join(info2, ";") {
+		t.Fatalf("fs error:\n%v\n%v", info1, info2)
+	}
+	if _, err := fsys.Stat("testdata/none"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Fatalf("stat error: %v", err)
+	}
+}
+
+func TestEmbedFS(t *testing.T) {
+	files := loadFS(t)
+	efs, err := NewEmbedFS(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(efs, "testdata/data1.txt", "testdata/one/data.txt"); err != nil {
+		t.Fatal(err)
+	}
+	info1 := fsInfo(t, fs)
+	info2 := fsInfo(t, efs)
+	if strings.Join(info1, ";") != strings.Join(info2, ";") {
+		t.Fatalf("embed fs error:\n%v\n%v", info1, info2)
+	}
+	list := BuildFS(files)
+	efiles := *(*myfs)(unsafe.Pointer(&efs)).files
+	if len(efiles) != len(list) {
+		t.Fatalf("embed fs files error: %v", efiles)
+	}
+	for i, f := range list {
+		if efiles[i].name != f.Name || efiles[i].data != string(f.Data) || efiles[i].hash != f.Hash {
+			t.Fatalf("embed fs file error: %v", efiles[i])
+		}
+	}
+}
+
+func TestEmbedLayout(t *testing.T) {
+	if err := checkEmbedLayout(reflect.TypeOf(embed.FS{})); err != nil {
+		t.Fatalf("%v %v", runtime.Version(), err)
+	}
+	type file116 struct {
+		name string
+		data string
+		hash [16]byte
+	}
+	type fs116 struct {
+		files *[]file116
+	}
+	if err := checkEmbedLayout(reflect.TypeOf(fs116{})); err != nil {
+		t.Fatal(err)
+	}
+	type fileNoHash struct {
+		name string
+		data string
+	}
+	type fsNoHash struct {
+		files *[]fileNoHash
+	}
+	type fsSlice struct {
+		files []file116
+	}
+	type fsExtra struct {
+		files *[]file116
+		mu    int
+	}
+	for _, v := range []interface{}{fsNoHash{}, fsSlice{}, fsExtra{}, file116{}} {
+		if err := checkEmbedLayout(reflect.TypeOf(v)); err == nil {
+			t.Fatalf("must have layout error: %T", v)
+		}
+	}
+}
+
+func TestToolchainHash(t *testing.T) {
+	hash, err := ToolchainHash("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	em := &Embed{Name: "hashfs", Kind: EmbedFiles, Patterns: []string{"testdata/_hash"}}
+	dir, _ := filepath.Abs(".")
+	for _, opts := range [][]ResolveOption{
+		{WithHash(hash)},
+		{WithHash(hash), WithLazy()},
+	} {
+		files, err := NewResolve(opts...).Load(dir, token.NewFileSet(), em)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = BuildFS(files)
+		mfiles := *(*myfs)(unsafe.Pointer(&hashfs)).files
+		if len(mfiles) != len(files) {
+			t.Fatalf("%v files error: %v", hash, files)
+		}
+		for i, f := range files {
+			if mfiles[i].name != f.Name || mfiles[i].hash != f.Hash {
+				t.Fatalf("%v hash error: %v %x, want %v %x", hash, f.Name, f.Hash, mfiles[i].name, mfiles[i].hash)
+			}
+		}
+	}
+	for _, test := range []struct {
+		version string
+		hash    HashKind
+	}{
+		{"go1.16", HashSHA256},
+		{"go1.18.10", HashSHA256},
+		{"go1.19", HashNotSHA256},
+		{"go1.23.4", HashNotSHA256},
+		{"go1.24", HashGo124},
+		{"1.26", HashGo124},
+	} {
+		if hash, err := ToolchainHash(test.version); err != nil || hash != test.hash {
+			t.Fatalf("ToolchainHash(%q) = %v, %v, want %v", test.version, hash, err, test.hash)
+		}
+	}
+	if _, err := ToolchainHash("go2"); err == nil {
+		t.Fatal("ToolchainHash(go2) must fail")
+	}
+}
+
+func TestHashKind(t *testing.T) {
+	large := strings.Repeat("a", 2000)
+	for _, test := range []struct {
+		kind HashKind
+		data string
+		want string
+	}{
+		{HashSHA256, "", "e3b0c44298fc1c149afbf4c8996fb924"},
+		{HashSHA256, "hello", "2cf24dba5fb0a30e26e83b2ac5b9e29e"},
+		{HashSHA256, large, "c4a700f85b7e9e5cdbdc51170409ee2a"},
+		{HashNotSHA256, "", "1c4f3bbd6703e3eb65040b37669046db"},
+		{HashNotSHA256, "hello", "d30db245a04f5cf1d917c4d53a461d61"},
+		{HashNotSHA256, large, "3b58ff07a48161a32423aee8fbf611d5"},
+		{HashGo124, "", "1cb0c44298fc1c149afbf4c8996fb924"},
+		{HashGo124, "hello", "d3f24dba5fb0a30e26e83b2ac5b9e29e"},
+		{HashGo124, large, "9c603499b7b65fe82da35a7ed911bc55"},
+		{HashNone, "", "00000000000000000000000000000000"},
+		{HashNone, "hello", "00000000000000000000000000000000"},
+	} {
+		if hash := fmt.Sprintf("%x", test.kind.sumData([]byte(test.data))); hash != test.want {
+			t.Fatalf("%v hash of %d bytes = %v, want %v", test.kind, len(test.data), hash, test.want)
+		}
+	}
+}
+
+func TestEmbedKindVersion(t *testing.T) {
+	src := `package p
+
+import "embed"
+
+type (
+	S  string
+	AS = string
+	B  []byte
+	AF = embed.FS
+)
+
+var (
+	s  string
+	b  []byte
+	fs embed.FS
+	ds S
+	as AS
+	db B
+	af AF
+)
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	tconf := &types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := tconf.Check("p", fset, []*ast.File{f}, info); err != nil {
+		t.Fatal(err)
+	}
+	specs := make(map[string]*ast.ValueSpec)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if vs, ok := n.(*ast.ValueSpec); ok {
+			specs[vs.Names[0].Name] = vs
+		}
+		return true
+	})
+	for _, test := range []struct {
+		name   string
+		minor  int
+		syntax Kind // kind of the type expression
+		types  Kind // kind with the type information
+	}{
+		{"s", 16, EmbedString, EmbedString},
+		{"b", 16, EmbedBytes, EmbedBytes},
+		{"fs", 16, EmbedFiles, EmbedFiles},
+		{"ds", 16, EmbedUnknown, EmbedUnknown},
+		{"as", 16, EmbedUnknown, EmbedUnknown},
+		{"db", 16, EmbedUnknown, EmbedUnknown},
+		{"af", 16, EmbedUnknown, EmbedUnknown},
+		{"s", 17, EmbedString, EmbedString},
+		{"b", 17, EmbedBytes, EmbedBytes},
+		{"fs", 17, EmbedFiles, EmbedFiles},
+		{"ds", 17, EmbedMaybeAlias, EmbedString},
+		{"as", 17, EmbedMaybeAlias, EmbedString},
+		{"db", 17, EmbedMaybeAlias, EmbedBytes},
+		{"af", 17, EmbedMaybeAlias, EmbedFiles},
+		{"ds", -1, EmbedMaybeAlias, EmbedString},
+		{"af", -1, EmbedMaybeAlias, EmbedFiles},
+	} {
+		vs := specs[test.name]
+		if kind := embedKind(vs.Type, "embed", test.minor); kind != test.syntax {
+			t.Errorf("embedKind(%v, %v) = %v, want %v", test.name, test.minor, kind, test.syntax)
+		}
+		c := &checker{fset: fset, info: info}
+		if kind := c.embedKind(vs.Names[0], vs.Type, "embed", test.minor); kind != test.types {
+			t.Errorf("checker.embedKind(%v, %v) = %v, want %v", test.name, test.minor, kind, test.types)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package goembed
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/visualfc/goembed/resolve"
+)
+
+// BuildEmbedCfg is build the -embedcfg file content of go tool compile
+// for the go:embed vars of the package in dir. The files are resolved
+// with NewResolve(opts...) and mapped to their absolute paths on disk,
+// honoring the overlay of the resolve.
+func BuildEmbedCfg(dir string, ems []*Embed, opts ...ResolveOption) ([]byte, error) {
+	return buildEmbedCfg(dir, ems, NewResolve(opts...))
+}
+
+// EmbedCfg is build the -embedcfg file content for the package go:embed vars,
+// using the resolve the package was loaded with.
+func (p *Package) EmbedCfg() ([]byte, error) {
+	r := p.resolve
+	if r == nil {
+		r = NewResolve()
+	}
+	return buildEmbedCfg(p.Dir, p.Embeds, r)
+}
+
+// buildEmbedCfg is build the -embedcfg file content with the resolve r.
+// The disk paths are taken from the file system of r if it is created
+// by NewResolve, or else from the OS file system. dir is made absolute
+// only for OS file systems, other file systems have their own paths.
+func buildEmbedCfg(dir string, ems []*Embed, r Resolve) ([]byte, error) {
+	rv := &resolve.Resolver{FS: resolve.OS}
+	if rf, ok := r.(*resolveFile); ok {
+		rv.FS = rf.fsys
+	}
+	if resolve.IsOS(rv.FS) {
+		var err error
+		if dir, err = filepath.Abs(dir); err != nil {
+			return nil, err
+		}
+	}
+	have := make(map[string]bool)
+	var files []string
+	pmap := make(map[string][]string)
+	for _, em := range ems {
+		res, err := r.Resolve(dir, em)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range res.Files {
+			if !have[file] {
+				have[file] = true
+				files = append(files, file)
+			}
+		}
+		for pattern, list := range res.PatternFiles {
+			pmap[pattern] = list
+		}
+	}
+	sort.Strings(files)
+	return rv.ToEmbedCfg(dir, files, pmap)
+}
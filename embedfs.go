@@ -0,0 +1,296 @@
+//go:build go1.16
+// +build go1.16
+
+package goembed
+
+import (
+	"errors"
+	"io"
+	iofs "io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS is a read-only collection of embed files, the runtime counterpart
+// of embed.FS. It implements fs.FS, fs.ReadDirFS, fs.ReadFileFS and
+// fs.StatFS with the same semantics as embed.FS.
+type FS struct {
+	files *[]*File // sorted by embedFileLess, as built by BuildFS
+}
+
+var (
+	_ iofs.ReadDirFS  = FS{}
+	_ iofs.ReadFileFS = FS{}
+	_ iofs.StatFS     = FS{}
+)
+
+// NewFS returns the FS of files, adding the directories by BuildFS
+func NewFS(files []*File) FS {
+	list := BuildFS(files)
+	return FS{&list}
+}
+
+// fsFile is a File as fs.FileInfo and fs.DirEntry
+type fsFile struct {
+	f *File
+}
+
+var (
+	_ iofs.FileInfo = fsFile{}
+	_ iofs.DirEntry = fsFile{}
+)
+
+func (f fsFile) Name() string                 { _, elem, _ := embedFileNameSplit(f.f.Name); return elem }
+func (f fsFile) Size() int64                  { return f.f.size() }
+func (f fsFile) ModTime() time.Time           { return time.Time{} }
+func (f fsFile) IsDir() bool                  { _, _, isDir := embedFileNameSplit(f.f.Name); return isDir }
+func (f fsFile) Sys() interface{}             { return nil }
+func (f fsFile) Type() iofs.FileMode          { return f.Mode().Type() }
+func (f fsFile) Info() (iofs.FileInfo, error) { return f, nil }
+
+func (f fsFile) Mode() iofs.FileMode {
+	if f.IsDir() {
+		return iofs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// dotFile is a file for the root directory,
+// which is omitted from the files list in a FS.
+var dotFile = &File{Name: "./"}
+
+// lookup returns the named file, or nil if it is not present.
+func (f FS) lookup(name string) *File {
+	if !iofs.ValidPath(name) {
+		return nil
+	}
+	if name == "." {
+		return dotFile
+	}
+	if f.files == nil {
+		return nil
+	}
+
+	// Binary search to find where name would be in the list,
+	// and then check if name is at that position.
+	dir, elem, _ := embedFileNameSplit(name)
+	files := *f.files
+	i := sort.Search(len(files), func(i int) bool {
+		idir, ielem, _ := embedFileNameSplit(files[i].Name)
+		return idir > dir || idir == dir && ielem >= elem
+	})
+	if i < len(files) && strings.TrimSuffix(files[i].Name, "/") == name {
+		return files[i]
+	}
+	return nil
+}
+
+// readDir returns the list of files corresponding to the directory dir.
+func (f FS) readDir(dir string) []*File {
+	if f.files == nil {
+		return nil
+	}
+	// Binary search to find where dir starts and ends in the list
+	// and then return that slice of the list.
+	files := *f.files
+	i := sort.Search(len(files), func(i int) bool {
+		idir, _, _ := embedFileNameSplit(files[i].Name)
+		return idir >= dir
+	})
+	j := sort.Search(len(files), func(j int) bool {
+		jdir, _, _ := embedFileNameSplit(files[j].Name)
+		return jdir > dir
+	})
+	return files[i:j]
+}
+
+// Open opens the named file for reading and returns it as an fs.File.
+// The data of lazy files is streamed by File.Open.
+func (f FS) Open(name string) (iofs.File, error) {
+	file := f.lookup(name)
+	if file == nil {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrNotExist}
+	}
+	if (fsFile{file}).IsDir() {
+		return &openDir{file, f.readDir(name), 0}, nil
+	}
+	if file.open == nil {
+		return &openFile{file, file.Data, 0}, nil
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: err}
+	}
+	lf := &lazyFile{file, rc}
+	if _, ok := rc.(lazySeeker); ok {
+		return &lazySeekFile{lf}, nil
+	}
+	return lf, nil
+}
+
+// ReadDir reads and returns the entire named directory.
+func (f FS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := file.(*openDir)
+	if !ok {
+		return nil, &iofs.PathError{Op: "read", Path: name, Err: errors.New("not a directory")}
+	}
+	list := make([]iofs.DirEntry, len(dir.files))
+	for i := range list {
+		list[i] = fsFile{dir.files[i]}
+	}
+	return list, nil
+}
+
+// ReadFile reads and returns the content of the named file.
+func (f FS) ReadFile(name string) ([]byte, error) {
+	file := f.lookup(name)
+	if file == nil {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrNotExist}
+	}
+	if (fsFile{file}).IsDir() {
+		return nil, &iofs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	if file.open == nil {
+		return append([]byte(nil), file.Data...), nil
+	}
+	data, err := file.ReadData()
+	if err != nil {
+		return nil, &iofs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// Stat returns a fs.FileInfo describing the named file.
+func (f FS) Stat(name string) (iofs.FileInfo, error) {
+	file := f.lookup(name)
+	if file == nil {
+		return nil, &iofs.PathError{Op: "stat", Path: name, Err: iofs.ErrNotExist}
+	}
+	return fsFile{file}, nil
+}
+
+// An openFile is a regular file open for reading.
+type openFile struct {
+	f      *File  // the file itself
+	data   []byte // the file data
+	offset int64  // current read offset
+}
+
+var (
+	_ io.Seeker   = (*openFile)(nil)
+	_ io.ReaderAt = (*openFile)(nil)
+)
+
+func (f *openFile) Close() error                 { return nil }
+func (f *openFile) Stat() (iofs.FileInfo, error) { return fsFile{f.f}, nil }
+
+func (f *openFile) Read(b []byte) (int, error) {
+	if f.offset >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	if f.offset < 0 {
+		return 0, &iofs.PathError{Op: "read", Path: f.f.Name, Err: iofs.ErrInvalid}
+	}
+	n := copy(b, f.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *openFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case 0:
+		// offset += 0
+	case 1:
+		offset += f.offset
+	case 2:
+		offset += int64(len(f.data))
+	}
+	if offset < 0 || offset > int64(len(f.data)) {
+		return 0, &iofs.PathError{Op: "seek", Path: f.f.Name, Err: iofs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *openFile) ReadAt(b []byte, offset int64) (int, error) {
+	if offset < 0 || offset > int64(len(f.data)) {
+		return 0, &iofs.PathError{Op: "read", Path: f.f.Name, Err: iofs.ErrInvalid}
+	}
+	n := copy(b, f.data[offset:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// A lazyFile is a lazy regular file open for reading.
+type lazyFile struct {
+	f  *File         // the file itself
+	rc io.ReadCloser // the file data stream
+}
+
+func (f *lazyFile) Close() error                 { return f.rc.Close() }
+func (f *lazyFile) Stat() (iofs.FileInfo, error) { return fsFile{f.f}, nil }
+func (f *lazyFile) Read(b []byte) (int, error)   { return f.rc.Read(b) }
+
+// lazySeeker is the data stream of a lazy file that can seek
+type lazySeeker interface {
+	io.Seeker
+	io.ReaderAt
+}
+
+// A lazySeekFile is a lazyFile whose data stream can seek.
+type lazySeekFile struct {
+	*lazyFile
+}
+
+var (
+	_ io.Seeker   = (*lazySeekFile)(nil)
+	_ io.ReaderAt = (*lazySeekFile)(nil)
+)
+
+func (f *lazySeekFile) Seek(offset int64, whence int) (int64, error) {
+	return f.rc.(lazySeeker).Seek(offset, whence)
+}
+
+func (f *lazySeekFile) ReadAt(b []byte, offset int64) (int, error) {
+	return f.rc.(lazySeeker).ReadAt(b, offset)
+}
+
+// An openDir is a directory open for reading.
+type openDir struct {
+	f      *File   // the directory file itself
+	files  []*File // the directory contents
+	offset int     // the read offset, an index into the files slice
+}
+
+func (d *openDir) Close() error                 { return nil }
+func (d *openDir) Stat() (iofs.FileInfo, error) { return fsFile{d.f}, nil }
+
+func (d *openDir) Read([]byte) (int, error) {
+	return 0, &iofs.PathError{Op: "read", Path: d.f.Name, Err: errors.New("is a directory")}
+}
+
+func (d *openDir) ReadDir(count int) ([]iofs.DirEntry, error) {
+	n := len(d.files) - d.offset
+	if n == 0 {
+		if count <= 0 {
+			return nil, nil
+		}
+		return nil, io.EOF
+	}
+	if count > 0 && n > count {
+		n = count
+	}
+	list := make([]iofs.DirEntry, n)
+	for i := range list {
+		list[i] = fsFile{d.files[d.offset+i]}
+	}
+	d.offset += n
+	return list, nil
+}
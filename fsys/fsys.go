@@ -7,9 +7,11 @@
 package fsys
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -30,26 +32,76 @@ var OverlayFile string
 // the Go command will forward all reads trying to open
 // each overlaid path to its replacement path, or consider the overlaid
 // path not to exist if the replacement path is empty.
+// The Contents map maps from overlaid paths to their contents,
+// like the unsaved buffers of an editor; a path must not be in both maps.
+// NewOverlay copies the contents, so the caller may reuse them.
 type OverlayJSON struct {
-	Replace map[string]string
+	Replace  map[string]string
+	Contents map[string][]byte `json:",omitempty"`
 }
 
 type node struct {
-	actualFilePath string           // empty if a directory
+	actualFilePath string           // empty if a directory or in memory
 	children       map[string]*node // path element → file or directory
+	contents       []byte           // contents of an in-memory file
+	inMemory       bool             // whether the file contents are in memory
 }
 
 func (n *node) isDir() bool {
-	return n.actualFilePath == "" && n.children != nil
+	return n.actualFilePath == "" && n.children != nil && !n.inMemory
 }
 
 func (n *node) isDeleted() bool {
-	return n.actualFilePath == "" && n.children == nil
+	return n.actualFilePath == "" && n.children == nil && !n.inMemory
 }
 
-// TODO(matloob): encapsulate these in an io/fs-like interface
-var overlay map[string]*node // path -> file or directory node
-var cwd string               // copy of base.Cwd to avoid dependency
+// File is an open file of the overlay file system.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+	Stat() (fs.FileInfo, error)
+}
+
+// Overlay is a file system with virtual overlays on top of the files
+// on disk. The zero Overlay has no overlaid files.
+// Overlays are not modified after they are created, so they can be
+// used concurrently.
+type Overlay struct {
+	overlay map[string]*node // path -> file or directory node
+	cwd     string           // directory of relative paths
+	modTime time.Time        // modification time of the in-memory files
+}
+
+// defaultOverlay is the overlay used by the package functions
+var defaultOverlay = &Overlay{}
+
+// NewOverlay returns the overlay of overlayJSON.
+// Relative paths are relative to cwd.
+func NewOverlay(cwd string, overlayJSON OverlayJSON) (*Overlay, error) {
+	o := &Overlay{cwd: cwd, modTime: time.Now()}
+	if err := o.initFromJSON(overlayJSON); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// ReadOverlay reads the overlay from file in the OverlayJSON format.
+// Relative paths are relative to cwd.
+func ReadOverlay(cwd string, file string) (*Overlay, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading overlay file: %v", err)
+	}
+
+	var overlayJSON OverlayJSON
+	if err := json.Unmarshal(b, &overlayJSON); err != nil {
+		return nil, fmt.Errorf("parsing overlay JSON: %v", err)
+	}
+
+	return NewOverlay(cwd, overlayJSON)
+}
 
 // Canonicalize a path for looking it up in the overlay.
 // Important: filepath.Join(cwd, path) doesn't always produce
@@ -57,7 +109,7 @@ var cwd string               // copy of base.Cwd to avoid dependency
 // Windows producing the correct absolute path requires making
 // a syscall. So this should only be used when looking up paths
 // in the overlay, or canonicalizing the paths in the overlay.
-func canonicalize(path string) string {
+func (o *Overlay) canonicalize(path string) string {
 	if path == "" {
 		return ""
 	}
@@ -65,7 +117,7 @@ func canonicalize(path string) string {
 		return filepath.Clean(path)
 	}
 
-	if v := filepath.VolumeName(cwd); v != "" && path[0] == filepath.Separator {
+	if v := filepath.VolumeName(o.cwd); v != "" && path[0] == filepath.Separator {
 		// On Windows filepath.Join(cwd, path) doesn't always work. In general
 		// filepath.Abs needs to make a syscall on Windows. Elsewhere in cmd/go
 		// use filepath.Join(cwd, path), but cmd/go specifically supports Windows
@@ -75,60 +127,71 @@ func canonicalize(path string) string {
 	}
 
 	// Make the path absolute.
-	return filepath.Join(cwd, path)
+	return filepath.Join(o.cwd, path)
 }
 
-// Init initializes the overlay, if one is being used.
+// Init initializes the overlay of the package functions from
+// OverlayFile, if one is being used.
 func Init(wd string) error {
-	if overlay != nil {
+	if defaultOverlay.overlay != nil {
 		// already initialized
 		return nil
 	}
 
-	cwd = wd
-
 	if OverlayFile == "" {
+		defaultOverlay = &Overlay{cwd: wd}
 		return nil
 	}
 
-	b, err := ioutil.ReadFile(OverlayFile)
+	o, err := ReadOverlay(wd, OverlayFile)
 	if err != nil {
-		return fmt.Errorf("reading overlay file: %v", err)
-	}
-
-	var overlayJSON OverlayJSON
-	if err := json.Unmarshal(b, &overlayJSON); err != nil {
-		return fmt.Errorf("parsing overlay JSON: %v", err)
+		return err
 	}
+	defaultOverlay = o
+	return nil
+}
 
-	return initFromJSON(overlayJSON)
+// Default returns the overlay used by the package functions.
+func Default() *Overlay {
+	return defaultOverlay
 }
 
-func initFromJSON(overlayJSON OverlayJSON) error {
+func (o *Overlay) initFromJSON(overlayJSON OverlayJSON) error {
 	// Canonicalize the paths in in the overlay map.
 	// Use reverseCanonicalized to check for collisions:
 	// no two 'from' paths should canonicalize to the same path.
-	overlay = make(map[string]*node)
+	overlay := make(map[string]*node)
+	o.overlay = overlay
 	reverseCanonicalized := make(map[string]string) // inverse of canonicalize operation, to check for duplicates
 	// Build a table of file and directory nodes from the replacement map.
 
 	// Remove any potential non-determinism from iterating over map by sorting it.
-	replaceFrom := make([]string, 0, len(overlayJSON.Replace))
+	replaceFrom := make([]string, 0, len(overlayJSON.Replace)+len(overlayJSON.Contents))
 	for k := range overlayJSON.Replace {
 		replaceFrom = append(replaceFrom, k)
 	}
+	for k := range overlayJSON.Contents {
+		if _, ok := overlayJSON.Replace[k]; ok {
+			return fmt.Errorf("path %q is in both Replace and Contents in overlay", k)
+		}
+		replaceFrom = append(replaceFrom, k)
+	}
 	sort.Strings(replaceFrom)
 
 	for _, from := range replaceFrom {
 		to := overlayJSON.Replace[from]
+		contents, inMemory := overlayJSON.Contents[from]
+		if inMemory {
+			contents = append([]byte(nil), contents...)
+		}
 		// Canonicalize paths and check for a collision.
 		if from == "" {
 			return fmt.Errorf("empty string key in overlay file Replace map")
 		}
-		cfrom := canonicalize(from)
+		cfrom := o.canonicalize(from)
 		if to != "" {
 			// Don't canonicalize "", meaning to delete a file, because then it will turn into ".".
-			to = canonicalize(to)
+			to = o.canonicalize(to)
 		}
 		if otherFrom, seen := reverseCanonicalized[cfrom]; seen {
 			return fmt.Errorf(
@@ -155,7 +218,7 @@ func initFromJSON(overlayJSON OverlayJSON) error {
 				}
 			}
 		}
-		overlay[from] = &node{actualFilePath: to}
+		overlay[from] = &node{actualFilePath: to, contents: contents, inMemory: inMemory}
 
 		// Add parent directory nodes to overlay structure.
 		childNode := overlay[from]
@@ -196,13 +259,19 @@ func initFromJSON(overlayJSON OverlayJSON) error {
 // IsDir returns true if path is a directory on disk or in the
 // overlay.
 func IsDir(path string) (bool, error) {
-	path = canonicalize(path)
+	return defaultOverlay.IsDir(path)
+}
+
+// IsDir returns true if path is a directory on disk or in the
+// overlay.
+func (o *Overlay) IsDir(path string) (bool, error) {
+	path = o.canonicalize(path)
 
-	if _, ok := parentIsOverlayFile(path); ok {
+	if _, ok := o.parentIsOverlayFile(path); ok {
 		return false, nil
 	}
 
-	if n, ok := overlay[path]; ok {
+	if n, ok := o.overlay[path]; ok {
 		return n.isDir(), nil
 	}
 
@@ -217,14 +286,14 @@ func IsDir(path string) (bool, error) {
 // parentIsOverlayFile returns whether name or any of
 // its parents are files in the overlay, and the first parent found,
 // including name itself, that's a file in the overlay.
-func parentIsOverlayFile(name string) (string, bool) {
-	if overlay != nil {
+func (o *Overlay) parentIsOverlayFile(name string) (string, bool) {
+	if o.overlay != nil {
 		// Check if name can't possibly be a directory because
 		// it or one of its parents is overlaid with a file.
 		// TODO(matloob): Maybe save this to avoid doing it every time?
 		prefix := name
 		for {
-			node := overlay[prefix]
+			node := o.overlay[prefix]
 			if node != nil && !node.isDir() {
 				return prefix, true
 			}
@@ -265,12 +334,18 @@ func readDir(dir string) ([]fs.FileInfo, error) {
 // ReadDir provides a slice of fs.FileInfo entries corresponding
 // to the overlaid files in the directory.
 func ReadDir(dir string) ([]fs.FileInfo, error) {
-	dir = canonicalize(dir)
-	if _, ok := parentIsOverlayFile(dir); ok {
+	return defaultOverlay.ReadDir(dir)
+}
+
+// ReadDir provides a slice of fs.FileInfo entries corresponding
+// to the overlaid files in the directory.
+func (o *Overlay) ReadDir(dir string) ([]fs.FileInfo, error) {
+	dir = o.canonicalize(dir)
+	if _, ok := o.parentIsOverlayFile(dir); ok {
 		return nil, &fs.PathError{Op: "ReadDir", Path: dir, Err: errNotDir}
 	}
 
-	dirNode := overlay[dir]
+	dirNode := o.overlay[dir]
 	if dirNode == nil {
 		return readDir(dir)
 	}
@@ -293,6 +368,8 @@ func ReadDir(dir string) ([]fs.FileInfo, error) {
 			files[name] = fakeDir(name)
 		case to.isDeleted():
 			delete(files, name)
+		case to.inMemory:
+			files[name] = memFile{name, to, o.modTime}
 		default:
 			// This is a regular file.
 			f, err := os.Lstat(to.actualFilePath)
@@ -323,22 +400,75 @@ func ReadDir(dir string) ([]fs.FileInfo, error) {
 // It returns true if the path is overlaid with a regular file
 // or deleted, and false otherwise.
 func OverlayPath(path string) (string, bool) {
-	if p, ok := overlay[canonicalize(path)]; ok && !p.isDir() {
+	return defaultOverlay.OverlayPath(path)
+}
+
+// OverlayPath returns the path to the overlaid contents of the
+// file, the empty string if the overlay deletes the file or the
+// contents of the file are in memory, or path itself if the file
+// is not in the overlay or the file is a directory in the overlay.
+// It returns true if the path is overlaid with a regular file,
+// in-memory contents or deleted, and false otherwise.
+// Use InMemory to tell in-memory contents from deleted files.
+func (o *Overlay) OverlayPath(path string) (string, bool) {
+	if p, ok := o.overlay[o.canonicalize(path)]; ok && !p.isDir() {
 		return p.actualFilePath, ok
 	}
 
 	return path, false
 }
 
+// InMemory reports whether the contents of the file are in memory.
+func InMemory(path string) bool {
+	return defaultOverlay.InMemory(path)
+}
+
+// InMemory reports whether the contents of the file are in memory.
+func (o *Overlay) InMemory(path string) bool {
+	node, ok := o.overlay[o.canonicalize(path)]
+	return ok && node.inMemory
+}
+
 // Open opens the file at or overlaid on the given path.
 func Open(path string) (*os.File, error) {
-	return OpenFile(path, os.O_RDONLY, 0)
+	return defaultOverlay.Open(path)
+}
+
+// Open opens the file at or overlaid on the given path.
+func (o *Overlay) Open(path string) (*os.File, error) {
+	return o.OpenFile(path, os.O_RDONLY, 0)
+}
+
+// OpenRead opens the file at or overlaid on the given path for reading.
+// Unlike Open, it also opens the files with in-memory contents.
+func OpenRead(path string) (File, error) {
+	return defaultOverlay.OpenRead(path)
+}
+
+// OpenRead opens the file at or overlaid on the given path for reading.
+// Unlike Open, it also opens the files with in-memory contents.
+func (o *Overlay) OpenRead(path string) (File, error) {
+	if o.InMemory(path) {
+		node := o.overlay[o.canonicalize(path)]
+		return &memReader{bytes.NewReader(node.contents), memFile{filepath.Base(path), node, o.modTime}}, nil
+	}
+	f, err := o.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
 // OpenFile opens the file at or overlaid on the given path with the flag and perm.
 func OpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
-	cpath := canonicalize(path)
-	if node, ok := overlay[cpath]; ok {
+	return defaultOverlay.OpenFile(path, flag, perm)
+}
+
+// OpenFile opens the file at or overlaid on the given path with the flag and perm.
+// The files with in-memory contents have no *os.File, use OpenRead to read them.
+func (o *Overlay) OpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	cpath := o.canonicalize(path)
+	if node, ok := o.overlay[cpath]; ok {
 		// Opening a file in the overlay.
 		if node.isDir() {
 			return nil, &fs.PathError{Op: "OpenFile", Path: path, Err: errors.New("fsys.OpenFile doesn't support opening directories yet")}
@@ -347,9 +477,12 @@ func OpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
 		if perm != os.FileMode(os.O_RDONLY) {
 			return nil, &fs.PathError{Op: "OpenFile", Path: path, Err: errors.New("overlaid files can't be opened for write")}
 		}
+		if node.inMemory {
+			return nil, &fs.PathError{Op: "OpenFile", Path: path, Err: errors.New("overlaid file contents are in memory, use OpenRead")}
+		}
 		return os.OpenFile(node.actualFilePath, flag, perm)
 	}
-	if parent, ok := parentIsOverlayFile(filepath.Dir(cpath)); ok {
+	if parent, ok := o.parentIsOverlayFile(filepath.Dir(cpath)); ok {
 		// The file is deleted explicitly in the Replace map,
 		// or implicitly because one of its parent directories was
 		// replaced by a file.
@@ -365,7 +498,13 @@ func OpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
 // IsDirWithGoFiles reports whether dir is a directory containing Go files
 // either on disk or in the overlay.
 func IsDirWithGoFiles(dir string) (bool, error) {
-	fis, err := ReadDir(dir)
+	return defaultOverlay.IsDirWithGoFiles(dir)
+}
+
+// IsDirWithGoFiles reports whether dir is a directory containing Go files
+// either on disk or in the overlay.
+func (o *Overlay) IsDirWithGoFiles(dir string) (bool, error) {
+	fis, err := o.ReadDir(dir)
 	if os.IsNotExist(err) || errors.Is(err, errNotDir) {
 		return false, nil
 	}
@@ -386,14 +525,14 @@ func IsDirWithGoFiles(dir string) (bool, error) {
 		if !strings.HasSuffix(fi.Name(), ".go") {
 			continue
 		}
-		if fi.Mode().IsRegular() {
+		if fi.Mode().IsRegular() || o.InMemory(filepath.Join(dir, fi.Name())) {
 			return true, nil
 		}
 
 		// fi is the result of an Lstat, so it doesn't follow symlinks.
 		// But it's okay if the file is a symlink pointing to a regular
 		// file, so use os.Stat to follow symlinks and check that.
-		actualFilePath, _ := OverlayPath(filepath.Join(dir, fi.Name()))
+		actualFilePath, _ := o.OverlayPath(filepath.Join(dir, fi.Name()))
 		fi, err := os.Stat(actualFilePath)
 		if err == nil && fi.Mode().IsRegular() {
 			return true, nil
@@ -409,12 +548,12 @@ func IsDirWithGoFiles(dir string) (bool, error) {
 
 // walk recursively descends path, calling walkFn. Copied, with some
 // modifications from path/filepath.walk.
-func walk(path string, info fs.FileInfo, walkFn filepath.WalkFunc) error {
+func (o *Overlay) walk(path string, info fs.FileInfo, walkFn filepath.WalkFunc) error {
 	if !info.IsDir() {
 		return walkFn(path, info, nil)
 	}
 
-	fis, readErr := ReadDir(path)
+	fis, readErr := o.ReadDir(path)
 	walkErr := walkFn(path, info, readErr)
 	// If readErr != nil, walk can't walk into this directory.
 	// walkErr != nil means walkFn want walk to skip this directory or stop walking.
@@ -429,7 +568,7 @@ func walk(path string, info fs.FileInfo, walkFn filepath.WalkFunc) error {
 
 	for _, fi := range fis {
 		filename := filepath.Join(path, fi.Name())
-		if walkErr = walk(filename, fi, walkFn); walkErr != nil {
+		if walkErr = o.walk(filename, fi, walkFn); walkErr != nil {
 			if !fi.IsDir() || walkErr != filepath.SkipDir {
 				return walkErr
 			}
@@ -441,11 +580,17 @@ func walk(path string, info fs.FileInfo, walkFn filepath.WalkFunc) error {
 // Walk walks the file tree rooted at root, calling walkFn for each file or
 // directory in the tree, including root.
 func Walk(root string, walkFn filepath.WalkFunc) error {
-	info, err := Lstat(root)
+	return defaultOverlay.Walk(root, walkFn)
+}
+
+// Walk walks the file tree rooted at root, calling walkFn for each file or
+// directory in the tree, including root.
+func (o *Overlay) Walk(root string, walkFn filepath.WalkFunc) error {
+	info, err := o.Lstat(root)
 	if err != nil {
 		err = walkFn(root, nil, err)
 	} else {
-		err = walk(root, info, walkFn)
+		err = o.walk(root, info, walkFn)
 	}
 	if err == filepath.SkipDir {
 		return nil
@@ -453,25 +598,35 @@ func Walk(root string, walkFn filepath.WalkFunc) error {
 	return err
 }
 
-// lstat implements a version of os.Lstat that operates on the overlay filesystem.
+// Lstat implements a version of os.Lstat that operates on the overlay filesystem.
 func Lstat(path string) (fs.FileInfo, error) {
-	return overlayStat(path, os.Lstat, "lstat")
+	return defaultOverlay.Lstat(path)
+}
+
+// Lstat implements a version of os.Lstat that operates on the overlay filesystem.
+func (o *Overlay) Lstat(path string) (fs.FileInfo, error) {
+	return o.overlayStat(path, os.Lstat, "lstat")
 }
 
 // Stat implements a version of os.Stat that operates on the overlay filesystem.
 func Stat(path string) (fs.FileInfo, error) {
-	return overlayStat(path, os.Stat, "stat")
+	return defaultOverlay.Stat(path)
+}
+
+// Stat implements a version of os.Stat that operates on the overlay filesystem.
+func (o *Overlay) Stat(path string) (fs.FileInfo, error) {
+	return o.overlayStat(path, os.Stat, "stat")
 }
 
 // overlayStat implements lstat or Stat (depending on whether os.Lstat or os.Stat is passed in).
-func overlayStat(path string, osStat func(string) (fs.FileInfo, error), opName string) (fs.FileInfo, error) {
-	cpath := canonicalize(path)
+func (o *Overlay) overlayStat(path string, osStat func(string) (fs.FileInfo, error), opName string) (fs.FileInfo, error) {
+	cpath := o.canonicalize(path)
 
-	if _, ok := parentIsOverlayFile(filepath.Dir(cpath)); ok {
+	if _, ok := o.parentIsOverlayFile(filepath.Dir(cpath)); ok {
 		return nil, &fs.PathError{Op: opName, Path: cpath, Err: fs.ErrNotExist}
 	}
 
-	node, ok := overlay[cpath]
+	node, ok := o.overlay[cpath]
 	if !ok {
 		// The file or directory is not overlaid.
 		return osStat(path)
@@ -482,6 +637,8 @@ func overlayStat(path string, osStat func(string) (fs.FileInfo, error), opName s
 		return nil, &fs.PathError{Op: "lstat", Path: cpath, Err: fs.ErrNotExist}
 	case node.isDir():
 		return fakeDir(filepath.Base(path)), nil
+	case node.inMemory:
+		return memFile{filepath.Base(path), node, o.modTime}, nil
 	default:
 		fi, err := osStat(node.actualFilePath)
 		if err != nil {
@@ -506,6 +663,30 @@ func (f fakeFile) ModTime() time.Time { return f.real.ModTime() }
 func (f fakeFile) IsDir() bool        { return f.real.IsDir() }
 func (f fakeFile) Sys() interface{}   { return f.real.Sys() }
 
+// memFile provides an fs.FileInfo implementation for an overlaid file
+// with in-memory contents. It is a read-only regular file.
+type memFile struct {
+	name    string
+	node    *node
+	modTime time.Time
+}
+
+func (f memFile) Name() string       { return f.name }
+func (f memFile) Size() int64        { return int64(len(f.node.contents)) }
+func (f memFile) Mode() fs.FileMode  { return 0444 }
+func (f memFile) ModTime() time.Time { return f.modTime }
+func (f memFile) IsDir() bool        { return false }
+func (f memFile) Sys() interface{}   { return nil }
+
+// memReader is an open overlaid file with in-memory contents.
+type memReader struct {
+	*bytes.Reader
+	info memFile
+}
+
+func (f *memReader) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memReader) Close() error               { return nil }
+
 // missingFile provides an fs.FileInfo for an overlaid file where the
 // destination file in the overlay doesn't exist. It returns zero values
 // for the fileInfo methods other than Name, set to the file's name, and Mode
@@ -533,12 +714,17 @@ func (f fakeDir) Sys() interface{}   { return nil }
 
 // Glob is like filepath.Glob but uses the overlay file system.
 func Glob(pattern string) (matches []string, err error) {
+	return defaultOverlay.Glob(pattern)
+}
+
+// Glob is like filepath.Glob but uses the overlay file system.
+func (o *Overlay) Glob(pattern string) (matches []string, err error) {
 	// Check pattern is well-formed.
 	if _, err := filepath.Match(pattern, ""); err != nil {
 		return nil, err
 	}
 	if !hasMeta(pattern) {
-		if _, err = Lstat(pattern); err != nil {
+		if _, err = o.Lstat(pattern); err != nil {
 			return nil, nil
 		}
 		return []string{pattern}, nil
@@ -553,7 +739,7 @@ func Glob(pattern string) (matches []string, err error) {
 	}
 
 	if !hasMeta(dir[volumeLen:]) {
-		return glob(dir, file, nil)
+		return o.glob(dir, file, nil)
 	}
 
 	// Prevent infinite recursion. See issue 15879.
@@ -562,12 +748,12 @@ func Glob(pattern string) (matches []string, err error) {
 	}
 
 	var m []string
-	m, err = Glob(dir)
+	m, err = o.Glob(dir)
 	if err != nil {
 		return
 	}
 	for _, d := range m {
-		matches, err = glob(d, file, matches)
+		matches, err = o.glob(d, file, matches)
 		if err != nil {
 			return
 		}
@@ -650,9 +836,9 @@ func cleanGlobPathWindows(path string) (prefixLen int, cleaned string) {
 // and appends them to matches. If the directory cannot be
 // opened, it returns the existing matches. New matches are
 // added in lexicographical order.
-func glob(dir, pattern string, matches []string) (m []string, e error) {
+func (o *Overlay) glob(dir, pattern string, matches []string) (m []string, e error) {
 	m = matches
-	fi, err := Stat(dir)
+	fi, err := o.Stat(dir)
 	if err != nil {
 		return // ignore I/O error
 	}
@@ -660,7 +846,7 @@ func glob(dir, pattern string, matches []string) (m []string, e error) {
 		return // ignore I/O error
 	}
 
-	list, err := ReadDir(dir)
+	list, err := o.ReadDir(dir)
 	if err != nil {
 		return // ignore I/O error
 	}
@@ -0,0 +1,148 @@
+// Package gen generates Go source that initializes go:embed vars
+// with the embed data as literals, for compilers and tools that have
+// the embed package but do not understand go:embed. The package still
+// imports embed, so it does not build with toolchains before go1.16.
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/printer"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/visualfc/goembed"
+)
+
+// FileName is the name of the generated file
+const FileName = "zz_embed.go"
+
+// Generate writes the Go source that initializes the go:embed vars of pkg,
+// not including the vars of test files. The embed.FS vars are set through
+// the layout of embed.FS known to the compiler; the generated code checks
+// the layout when initialized and panics if it is unknown.
+func Generate(w io.Writer, pkg *goembed.Package) error {
+	var embeds []*goembed.Embed
+	needUnsafe := false
+	for _, em := range pkg.Embeds {
+		if strings.HasSuffix(em.Pos.Filename, "_test.go") {
+			continue
+		}
+		if em.Kind == goembed.EmbedFiles {
+			needUnsafe = true
+		}
+		embeds = append(embeds, em)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by goembed; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %v\n\n", pkg.Name)
+	if needUnsafe {
+		fmt.Fprintf(&buf, "import (\n_goembed_reflect \"reflect\"\n_goembed_unsafe \"unsafe\"\n)\n\n")
+	}
+	fmt.Fprintf(&buf, "func init() {\n")
+	for _, em := range embeds {
+		files := pkg.EmbedFiles[em]
+		var data []byte
+		if em.Kind != goembed.EmbedFiles && len(files) > 0 {
+			var err error
+			if data, err = files[0].ReadData(); err != nil {
+				return err
+			}
+		}
+		switch em.Kind {
+		case goembed.EmbedString:
+			fmt.Fprintf(&buf, "%v = \"%v\"\n", em.Name, goembed.BytesToHex(data))
+		case goembed.EmbedBytes:
+			typ := typeString(pkg, em.Spec.Type)
+			if _, ok := em.Spec.Type.(*ast.ArrayType); ok {
+				fmt.Fprintf(&buf, "%v = %v{%v}\n", em.Name, typ, goembed.BytesToList(data))
+			} else {
+				fmt.Fprintf(&buf, "%v = %v(\"%v\")\n", em.Name, typ, goembed.BytesToHex(data))
+			}
+		case goembed.EmbedMaybeAlias:
+			fmt.Fprintf(&buf, "%v = %v(\"%v\")\n", em.Name, typeString(pkg, em.Spec.Type), goembed.BytesToHex(data))
+		case goembed.EmbedFiles:
+			if err := writeFS(&buf, em.Name, goembed.BuildFS(files)); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%v: go:embed cannot apply to var of type %v", em.Pos, typeString(pkg, em.Spec.Type))
+		}
+	}
+	fmt.Fprintf(&buf, "}\n")
+	if needUnsafe {
+		fmt.Fprint(&buf, checkFS)
+	}
+	data, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// WriteFile generates the FileName file in the directory of pkg
+// and returns its path.
+func WriteFile(pkg *goembed.Package) (string, error) {
+	var buf bytes.Buffer
+	if err := Generate(&buf, pkg); err != nil {
+		return "", err
+	}
+	filename := filepath.Join(pkg.Dir, FileName)
+	return filename, ioutil.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+// writeFS writes the statements that set the embed.FS var name to files,
+// using the layout of embed.FS known to the compiler. The generated
+// identifiers are mangled, so that they do not shadow the var.
+func writeFS(w io.Writer, name string, files []*goembed.File) error {
+	fmt.Fprintf(w, "{\n")
+	fmt.Fprintf(w, "type _goembed_file struct {\nname string\ndata string\nhash [16]byte\n}\n")
+	fmt.Fprintf(w, "_goembed_files := []_goembed_file{\n")
+	for _, f := range files {
+		data, err := f.ReadData()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "{%q, \"%v\", [16]byte{%v}},\n", f.Name, goembed.BytesToHex(data), goembed.BytesToList(f.Hash[:]))
+	}
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "_goembed_checkFS(_goembed_reflect.TypeOf(%v), _goembed_reflect.TypeOf(_goembed_files))\n", name)
+	fmt.Fprintf(w, "*(**[]_goembed_file)(_goembed_unsafe.Pointer(&%v)) = &_goembed_files\n", name)
+	fmt.Fprintf(w, "}\n")
+	return nil
+}
+
+// checkFS is the source of the function that checks the layout of
+// embed.FS like goembed.NewEmbedFS, before the files are set.
+const checkFS = `
+// _goembed_checkFS panics if the embed.FS type typ is not a pointer
+// to the file list of type files.
+func _goembed_checkFS(typ, files _goembed_reflect.Type) {
+	if typ.Kind() == _goembed_reflect.Struct && typ.NumField() == 1 && typ.Size() == _goembed_unsafe.Sizeof(uintptr(0)) {
+		f := typ.Field(0).Type
+		if typ.Field(0).Name == "files" && f.Kind() == _goembed_reflect.Ptr && f.Elem().Kind() == _goembed_reflect.Slice {
+			typ, want := f.Elem().Elem(), files.Elem()
+			ok := typ.Kind() == _goembed_reflect.Struct && typ.NumField() == want.NumField() && typ.Size() == want.Size()
+			for i := 0; ok && i < typ.NumField(); i++ {
+				f, w := typ.Field(i), want.Field(i)
+				ok = f.Name == w.Name && f.Offset == w.Offset && f.Type == w.Type
+			}
+			if ok {
+				return
+			}
+		}
+	}
+	panic("goembed: unknown embed.FS layout")
+}
+`
+
+func typeString(pkg *goembed.Package, typ ast.Expr) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, pkg.Fset, typ)
+	return buf.String()
+}
@@ -0,0 +1,159 @@
+package gen_test
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/visualfc/goembed"
+	"github.com/visualfc/goembed/gen"
+)
+
+var src = `package demo
+
+import "embed"
+
+type T []byte
+
+//go:embed hello.txt
+var s string
+
+//go:embed hello.txt
+var b []byte
+
+//go:embed hello.txt
+var t T
+
+//go:embed static
+var fs embed.FS
+`
+
+// generate writes src and files to a temporary directory, and returns
+// the directory and the source generated for the package.
+func generate(t *testing.T, src string, files map[string]string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	files["demo.go"] = src
+	for name, data := range files {
+		fpath := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(fpath), 0755)
+		if err := ioutil.WriteFile(fpath, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pkg, err := goembed.LoadPackage(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := gen.Generate(&buf, pkg); err != nil {
+		t.Fatal(err)
+	}
+	return dir, buf.String()
+}
+
+// typeCheck type checks src with the generated source out
+func typeCheck(t *testing.T, pkg, src, out string) {
+	t.Helper()
+	fset := token.NewFileSet()
+	f1, err := parser.ParseFile(fset, "demo.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := parser.ParseFile(fset, gen.FileName, out, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check(pkg, fset, []*ast.File{f1, f2}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	_, out := generate(t, src, map[string]string{
+		"hello.txt":       "hello",
+		"static/data.txt": "data",
+	})
+	for _, want := range []string{
+		"// Code generated by goembed; DO NOT EDIT.",
+		`_goembed_reflect "reflect"`,
+		`_goembed_unsafe "unsafe"`,
+		`s = "\x68\x65\x6c\x6c\x6f"`,
+		`b = []byte{104, 101, 108, 108, 111}`,
+		`t = T("\x68\x65\x6c\x6c\x6f")`,
+		`{"static/data.txt", "\x64\x61\x74\x61", [16]byte{`,
+		`_goembed_checkFS(_goembed_reflect.TypeOf(fs), _goembed_reflect.TypeOf(_goembed_files))
+		*(**[]_goembed_file)(_goembed_unsafe.Pointer(&fs)) = &_goembed_files`,
+		`panic("goembed: unknown embed.FS layout")`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("generate error: %q not found in\n%v", want, out)
+		}
+	}
+	typeCheck(t, "demo", src, out)
+}
+
+func TestGenerateNames(t *testing.T) {
+	for _, name := range []string{"files", "file", "reflect", "unsafe"} {
+		src := `package demo
+
+import "embed"
+
+//go:embed static
+var ` + name + ` embed.FS
+`
+		_, out := generate(t, src, map[string]string{"static/data.txt": "data"})
+		if want := "_goembed_reflect.TypeOf(" + name + ")"; !strings.Contains(out, want) {
+			t.Fatalf("generate %v error: %q not found in\n%v", name, want, out)
+		}
+		typeCheck(t, "demo", src, out)
+	}
+}
+
+// TestGenerateRun runs a program with the generated source, so that
+// the embed.FS var is set by the generated init.
+func TestGenerateRun(t *testing.T) {
+	gocmd := filepath.Join(runtime.GOROOT(), "bin", "go")
+	if _, err := os.Stat(gocmd); err != nil {
+		t.Skip(err)
+	}
+	src := `package main
+
+import (
+	"embed"
+	"fmt"
+)
+
+//go:embed static
+var files embed.FS
+
+func main() {
+	data, err := files.ReadFile("static/data.txt")
+	fmt.Print(string(data), err)
+}
+`
+	dir, out := generate(t, src, map[string]string{
+		"go.mod":          "module demo\n\ngo 1.16\n",
+		"static/data.txt": "data",
+	})
+	if err := ioutil.WriteFile(filepath.Join(dir, gen.FileName), []byte(out), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(gocmd, "run", ".")
+	cmd.Dir = dir
+	data, err := cmd.CombinedOutput()
+	if err != nil || string(data) != "data<nil>" {
+		t.Fatalf("run error: %v\n%s", err, data)
+	}
+}
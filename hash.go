@@ -0,0 +1,113 @@
+package goembed
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/visualfc/goembed/internal/goversion"
+)
+
+// HashKind is the hash algorithm of embed file data
+type HashKind int
+
+// The hash of an empty file is the hash of no data for every kind but
+// HashNone. Before, the HashSHA256 hash of an empty file was zero.
+const (
+	HashSHA256    HashKind = iota // truncated SHA256, the go1.16 to go1.18 compiler hash
+	HashNotSHA256                 // truncated NOTSHA256, the go1.19 to go1.23 compiler hash
+	HashGo124                     // the go1.24 and later compiler hash
+	HashNone                      // no hash, File.Hash is zero
+)
+
+func (k HashKind) String() string {
+	switch k {
+	case HashSHA256:
+		return "sha256"
+	case HashNotSHA256:
+		return "notsha256"
+	case HashGo124:
+		return "go1.24"
+	case HashNone:
+		return "none"
+	}
+	return fmt.Sprintf("HashKind(%d)", int(k))
+}
+
+// ToolchainHash returns the hash kind the compiler of Go version uses
+// for embed.FS files, so that File.Hash matches compiled binaries.
+// The version is a release like "go1.21"; empty is the running toolchain.
+func ToolchainHash(version string) (HashKind, error) {
+	minor := goversion.Current()
+	if version != "" {
+		var ok bool
+		if minor, ok = goversion.Minor(version); !ok {
+			return HashSHA256, fmt.Errorf("invalid go version %q", version)
+		}
+	}
+	return toolchainHash(minor), nil
+}
+
+func toolchainHash(minor int) HashKind {
+	switch {
+	case minor >= 24:
+		return HashGo124
+	case minor >= 19:
+		return HashNotSHA256
+	}
+	return HashSHA256
+}
+
+// go124SmallSize is the maximum size of data the go1.24 compiler hashes
+// with cmd/internal/hash.Sum32 instead of New32.
+const go124SmallSize = 1024
+
+// sum returns the truncated hash of the data read from r and its size.
+func (k HashKind) sum(r io.Reader) (hash [16]byte, n int64, err error) {
+	switch k {
+	case HashNone:
+		n, err = io.Copy(ioutil.Discard, r)
+		return
+	case HashGo124:
+		buf := make([]byte, go124SmallSize+1)
+		m, err := io.ReadFull(r, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			sum := sha256.Sum256(buf[:m])
+			sum[0] ^= 0xff
+			copy(hash[:], sum[:])
+			return hash, int64(m), nil
+		} else if err != nil {
+			return hash, 0, err
+		}
+		h := sha256.New()
+		h.Write([]byte{1})
+		h.Write(buf)
+		n, err = io.Copy(h, r)
+		if err != nil {
+			return hash, 0, err
+		}
+		copy(hash[:], h.Sum(nil))
+		return hash, n + int64(m), nil
+	}
+	h := sha256.New()
+	n, err = io.Copy(h, r)
+	if err != nil {
+		return
+	}
+	sum := h.Sum(nil)
+	if k == HashNotSHA256 {
+		for i := range sum {
+			sum[i] ^= 0xff
+		}
+	}
+	copy(hash[:], sum)
+	return
+}
+
+// sumData returns the truncated hash of data.
+func (k HashKind) sumData(data []byte) [16]byte {
+	hash, _, _ := k.sum(bytes.NewReader(data))
+	return hash
+}
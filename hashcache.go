@@ -0,0 +1,113 @@
+package goembed
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// hashCacheModTimeSlop is the time a file must be unmodified before its
+	// hash is cached, so that a write in the same mtime tick is not missed.
+	hashCacheModTimeSlop = 2 * time.Second
+
+	// hashCacheTrimInterval is the time between trims of the cache, and
+	// the resolution of the use time of the entries.
+	hashCacheTrimInterval = 24 * time.Hour
+
+	// hashCacheTrimLimit is the time after which unused entries are trimmed.
+	hashCacheTrimLimit = 5 * 24 * time.Hour
+)
+
+// hashCache is an on-disk cache of embed file hashes, keyed by the
+// hash kind and the disk path, size, modification time and inode of
+// the file. Like the go build cache, the modification time of an entry
+// is its last use, and entries unused for five days are trimmed.
+type hashCache struct {
+	dir      string
+	trimOnce sync.Once
+}
+
+// key returns the cache key of the kind hash of the file at the disk
+// path fpath with info. The key is empty if the file cannot be cached.
+func (c *hashCache) key(fpath string, info os.FileInfo, kind HashKind) string {
+	mtime := info.ModTime()
+	if mtime.IsZero() || time.Since(mtime) < hashCacheModTimeSlop {
+		return ""
+	}
+	if abs, err := filepath.Abs(fpath); err == nil {
+		fpath = abs
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "goembed hash %v\x00%s\x00%d\x00%d\x00%d\n", kind, fpath, info.Size(), mtime.UnixNano(), fileInode(info))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// get returns the cached hash of key.
+func (c *hashCache) get(key string) (hash [16]byte, ok bool) {
+	fpath := filepath.Join(c.dir, key)
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil || len(data) != len(hash) {
+		return hash, false
+	}
+	copy(hash[:], data)
+	c.used(fpath)
+	return hash, true
+}
+
+// used marks the entry fpath as used now, at most once per trim interval.
+func (c *hashCache) used(fpath string) {
+	if info, err := os.Stat(fpath); err == nil && time.Since(info.ModTime()) < hashCacheTrimInterval {
+		return
+	}
+	now := time.Now()
+	os.Chtimes(fpath, now, now)
+}
+
+// put stores hash as key. The entry is written to a temporary file and
+// renamed, so concurrent readers never see a partial entry.
+func (c *hashCache) put(key string, hash [16]byte) error {
+	if err := os.MkdirAll(c.dir, 0777); err != nil {
+		return err
+	}
+	c.trimOnce.Do(c.trim)
+	f, err := ioutil.TempFile(c.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(hash[:])
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(c.dir, key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// trim removes the entries unused for hashCacheTrimLimit, at most once
+// per trim interval as recorded by the modification time of trim.txt.
+func (c *hashCache) trim() {
+	stamp := filepath.Join(c.dir, "trim.txt")
+	if info, err := os.Stat(stamp); err == nil && time.Since(info.ModTime()) < hashCacheTrimInterval {
+		return
+	}
+	entries, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-hashCacheTrimLimit)
+	for _, e := range entries {
+		if e.Name() != "trim.txt" && e.Mode().IsRegular() && e.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(c.dir, e.Name()))
+		}
+	}
+	ioutil.WriteFile(stamp, []byte(fmt.Sprintf("%d", time.Now().Unix())), 0666)
+}
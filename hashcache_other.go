@@ -0,0 +1,13 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package goembed
+
+import (
+	"os"
+)
+
+// fileInode returns the inode number of info, or 0 if unknown.
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
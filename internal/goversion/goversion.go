@@ -0,0 +1,43 @@
+// Package goversion parses Go release versions.
+package goversion
+
+import (
+	"go/build"
+	"strconv"
+	"strings"
+)
+
+// Minor returns the minor version of the Go 1 release v,
+// such as 21 for "go1.21", "go1.21.3", "go1.21rc1" or "1.21".
+// It reports false if v is not a Go 1 release version.
+func Minor(v string) (int, bool) {
+	v = strings.TrimPrefix(v, "go")
+	if !strings.HasPrefix(v, "1.") {
+		return 0, false
+	}
+	v = v[2:]
+	i := 0
+	for i < len(v) && v[i] >= '0' && v[i] <= '9' {
+		i++
+	}
+	if i == 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v[:i])
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// Current returns the minor version of the running Go toolchain,
+// taken from the release tags of go/build.
+func Current() int {
+	var n int
+	for _, tag := range build.Default.ReleaseTags {
+		if m, ok := Minor(tag); ok && m > n {
+			n = m
+		}
+	}
+	return n
+}
@@ -0,0 +1,38 @@
+package goversion
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestMinor(t *testing.T) {
+	for _, test := range []struct {
+		v     string
+		minor int
+		ok    bool
+	}{
+		{"go1.16", 16, true},
+		{"go1.21.3", 21, true},
+		{"go1.22rc1", 22, true},
+		{"1.18", 18, true},
+		{"go1", 0, false},
+		{"go2.0", 0, false},
+		{"go1.x", 0, false},
+		{"", 0, false},
+	} {
+		minor, ok := Minor(test.v)
+		if minor != test.minor || ok != test.ok {
+			t.Fatalf("Minor(%q) = %v, %v, want %v, %v", test.v, minor, ok, test.minor, test.ok)
+		}
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	v := runtime.Version()
+	if minor, ok := Minor(v); ok && minor != Current() {
+		t.Fatalf("Current() = %v, want %v", Current(), v)
+	}
+	if Current() < 16 {
+		t.Fatalf("Current() = %v", Current())
+	}
+}
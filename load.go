@@ -0,0 +1,174 @@
+package goembed
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LoadOptions controls LoadPackage
+type LoadOptions struct {
+	Tests         bool     // include the package _test.go files
+	XTests        bool     // include the external test package _test.go files
+	BuildTags     []string // additional build tags
+	Resolve       Resolve  // resolve used to load embed data, nil use NewResolve()
+	AllErrors     bool     // report all errors as a scanner.ErrorList with the loaded package
+	TargetVersion string   // Go version to check for, like the go directive of go.mod, empty is the go directive of the package module
+	EmbedsOnly    bool     // only check the go:embed vars, do not load their files
+}
+
+// Package describes a package and its resolved go:embed vars
+type Package struct {
+	Dir        string
+	ImportPath string
+	Name       string
+	Fset       *token.FileSet
+	Embeds     []*Embed           // go:embed vars
+	EmbedFiles map[*Embed][]*File // files of each go:embed var
+
+	resolve Resolve // resolve used to load the files
+}
+
+// Files returns the files of all go:embed vars
+func (p *Package) Files() (files []*File) {
+	have := make(map[string]bool)
+	for _, em := range p.Embeds {
+		for _, f := range p.EmbedFiles[em] {
+			if !have[f.Name] {
+				have[f.Name] = true
+				files = append(files, f)
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return embedFileLess(files[i].Name, files[j].Name)
+	})
+	return
+}
+
+// LoadPackage imports the package in dir, checks its go:embed vars
+// and loads their files, unless opts.EmbedsOnly is set. A nil opts
+// uses the default options.
+// If opts.AllErrors is set, the errors of all go:embed vars are
+// returned as a scanner.ErrorList together with the package.
+func LoadPackage(dir string, opts *LoadOptions) (*Package, error) {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	ctxt := build.Default
+	ctxt.BuildTags = append(append([]string(nil), ctxt.BuildTags...), opts.BuildTags...)
+	bp, err := ctxt.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	target := opts.TargetVersion
+	if target == "" {
+		target = ModuleGoVersion(bp.Dir)
+	}
+	pkg := &Package{
+		Dir:        bp.Dir,
+		ImportPath: bp.ImportPath,
+		Name:       bp.Name,
+		Fset:       token.NewFileSet(),
+		EmbedFiles: make(map[*Embed][]*File),
+	}
+	type group struct {
+		files           []string
+		embedPatternPos map[string][]token.Position
+	}
+	groups := []group{{append(append([]string(nil), bp.GoFiles...), bp.CgoFiles...), bp.EmbedPatternPos}}
+	if opts.Tests {
+		groups = append(groups, group{bp.TestGoFiles, bp.TestEmbedPatternPos})
+	}
+	if opts.XTests {
+		groups = append(groups, group{bp.XTestGoFiles, bp.XTestEmbedPatternPos})
+	}
+	var errs scanner.ErrorList
+	for _, g := range groups {
+		if len(g.embedPatternPos) == 0 {
+			continue
+		}
+		var files []*ast.File
+		for _, name := range g.files {
+			f, err := parser.ParseFile(pkg.Fset, filepath.Join(bp.Dir, name), nil, 0)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, f)
+		}
+		conf := &Config{AllErrors: opts.AllErrors, TargetVersion: target}
+		ems, err := conf.CheckEmbed(g.embedPatternPos, pkg.Fset, files)
+		if err != nil {
+			if !opts.AllErrors {
+				return nil, err
+			}
+			errs = appendError(errs, err)
+		}
+		pkg.Embeds = append(pkg.Embeds, ems...)
+	}
+	r := opts.Resolve
+	if r == nil {
+		var ropts []ResolveOption
+		if opts.AllErrors {
+			ropts = append(ropts, WithAllErrors())
+		}
+		if target != "" {
+			ropts = append(ropts, WithTargetVersion(target))
+		}
+		r = NewResolve(ropts...)
+	}
+	pkg.resolve = r
+	if !opts.EmbedsOnly {
+		for _, em := range pkg.Embeds {
+			files, err := r.Load(bp.Dir, pkg.Fset, em)
+			if err != nil {
+				if !opts.AllErrors {
+					return nil, err
+				}
+				errs = appendError(errs, err)
+			}
+			pkg.EmbedFiles[em] = files
+		}
+	}
+	if len(errs) > 0 {
+		errs.Sort()
+		return pkg, errs
+	}
+	return pkg, nil
+}
+
+// ModuleGoVersion returns the go directive of the go.mod file of the
+// module containing dir, or empty if there is no go.mod file or it has
+// no go directive.
+func ModuleGoVersion(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if f := strings.Fields(line); len(f) >= 2 && f[0] == "go" {
+					return f[1]
+				}
+			}
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
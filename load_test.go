@@ -1,15 +1,31 @@
 package goembed_test
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"go/ast"
+	"go/importer"
 	"go/parser"
+	"go/scanner"
 	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/visualfc/goembed"
 
+	"github.com/visualfc/goembed/fsys"
 	embedparser "github.com/visualfc/goembed/parser"
+	"github.com/visualfc/goembed/resolve"
 )
 
 func parserFile(fset *token.FileSet, src string) (*ast.File, error) {
@@ -28,35 +44,139 @@ func parserEmbed(fset *token.FileSet, f *ast.File) ([]*goembed.Embed, error) {
 	return goembed.CheckEmbed(eps.PatternPos, fset, []*ast.File{f})
 }
 
-func load(src string) ([]*goembed.File, error) {
+// loadConfig is the configuration of load
+type loadConfig struct {
+	dir     string                  // package directory, empty is the working directory
+	conf    goembed.Config          // configuration of CheckEmbed
+	resolve []goembed.ResolveOption // options of NewResolve
+}
+
+type loadOption func(c *loadConfig)
+
+// withDir loads the package in dir
+func withDir(dir string) loadOption {
+	return func(c *loadConfig) {
+		c.dir = dir
+	}
+}
+
+// withConfig checks the go:embed vars with conf
+func withConfig(conf goembed.Config) loadOption {
+	return func(c *loadConfig) {
+		c.conf = conf
+	}
+}
+
+// withResolve loads the files with NewResolve(opts...)
+func withResolve(opts ...goembed.ResolveOption) loadOption {
+	return func(c *loadConfig) {
+		c.resolve = append(c.resolve, opts...)
+	}
+}
+
+// load parses src, checks its go:embed vars and loads their files.
+// If the go:embed vars are checked with AllErrors, the errors of all
+// vars are returned as a sorted scanner.ErrorList.
+func load(src string, opts ...loadOption) ([]*goembed.File, error) {
+	var c loadConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
 	fset := token.NewFileSet()
 	f, err := parserFile(fset, src)
 	if err != nil {
 		return nil, err
 	}
-	ems, err := parserEmbed(fset, f)
+	eps, err := embedparser.ParseEmbed(fset, []*ast.File{f})
 	if err != nil {
 		return nil, err
 	}
-	r := goembed.NewResolve()
-	wd, _ := os.Getwd()
+	var errs scanner.ErrorList
+	ems, err := c.conf.CheckEmbed(eps.PatternPos, fset, []*ast.File{f})
+	if err != nil {
+		if !c.conf.AllErrors {
+			return nil, err
+		}
+		errs = append(errs, err.(scanner.ErrorList)...)
+	}
+	r := goembed.NewResolve(c.resolve...)
+	dir := c.dir
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
 	for _, em := range ems {
-		_, err := r.Load(wd, fset, em)
+		_, err := r.Load(dir, fset, em)
 		if err != nil {
-			return nil, err
+			list, ok := err.(scanner.ErrorList)
+			if !ok || !c.conf.AllErrors {
+				return nil, err
+			}
+			errs = append(errs, list...)
 		}
 	}
+	if len(errs) > 0 {
+		errs.Sort()
+		return r.Files(), errs
+	}
 	return r.Files(), nil
 }
 
-func testError(src string, want string, t *testing.T) {
-	_, err := load(src)
+// parseEmbeds parses src and returns its go:embed vars
+func parseEmbeds(t *testing.T, src string) (*token.FileSet, []*goembed.Embed) {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parserFile(fset, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ems, err := parserEmbed(fset, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fset, ems
+}
+
+// writeFiles writes the slash-separated files to a temporary
+// directory and returns the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		fpath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// testError checks the error of load, see errorString.
+func testError(src string, want string, t *testing.T, opts ...loadOption) {
+	t.Helper()
+	_, err := load(src, opts...)
 	if err == nil {
 		t.Fatalf("must have error: %v", want)
 	}
-	if err.Error() != want {
-		t.Fatalf("\nwant %v\nhave %v", want, err)
+	if have := errorString(err); have != want {
+		t.Fatalf("\nwant %v\nhave %v", want, have)
+	}
+}
+
+// errorString returns the message of err, with the errors
+// of a scanner.ErrorList one per line.
+func errorString(err error) string {
+	list, ok := err.(scanner.ErrorList)
+	if !ok {
+		return err.Error()
+	}
+	var lines []string
+	for _, e := range list {
+		lines = append(lines, e.Error())
 	}
+	return strings.Join(lines, "\n")
 }
 
 type File struct {
@@ -64,8 +184,9 @@ type File struct {
 	Data string
 }
 
-func testLoad(src string, data []*File, t *testing.T) {
-	files, err := load(src)
+func testLoad(src string, data []*File, t *testing.T, opts ...loadOption) {
+	t.Helper()
+	files, err := load(src, opts...)
 	if err != nil {
 		t.Fatalf("load error: %v", err)
 	}
@@ -76,8 +197,12 @@ func testLoad(src string, data []*File, t *testing.T) {
 		if v.Name != data[i].Name {
 			t.Fatalf("\nwant %v, have %v", data[i].Name, v.Name)
 		}
-		if string(v.Data) != data[i].Data {
-			t.Fatalf("\nwant %v, have %v", data[i].Data, string(v.Data))
+		vdata, err := v.ReadData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(vdata) != data[i].Data || v.Size != int64(len(data[i].Data)) {
+			t.Fatalf("\nwant %v, have %v", data[i].Data, string(vdata))
 		}
 	}
 }
@@ -178,6 +303,99 @@ func main() {
 	testError(src, `./main.go:5:3: misplaced go:embed directive`, t)
 }
 
+func TestErrorMisplacedDecl(t *testing.T) {
+	for _, test := range []struct {
+		decl string
+		want string
+	}{
+		{"//go:embed testdata/data1.txt\nconst data = \"\"", "./main.go:5:3: misplaced go:embed directive"},
+		{"//go:embed testdata/data1.txt\ntype data string", "./main.go:5:3: misplaced go:embed directive"},
+		{"//go:embed testdata/data1.txt\nvar (\n\tdata string\n)", "./main.go:5:3: misplaced go:embed directive"},
+		{"var (\n\tdata int\n\t//go:embed testdata/data1.txt\n)\n\nvar data2 string", "./main.go:7:4: misplaced go:embed directive"},
+		{"func f() {\n\t//go:embed testdata/data1.txt\n}\n\nvar data string", "./main.go:6:4: misplaced go:embed directive"},
+		{"func f() {\n\t//go:embed testdata/data1.txt\n\tconst data = \"\"\n}", "./main.go:6:4: misplaced go:embed directive"},
+	} {
+		src := "package main\n\nimport _ \"embed\"\n\n" + test.decl + "\n\nfunc main() {\n}\n"
+		testError(src, test.want, t)
+	}
+}
+
+func TestEmbedMergeBlankLines(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed testdata/data1.txt
+
+// data is merged from the directives above and below
+//go:embed testdata/data2.txt
+var data embed.FS
+
+func main() {
+}
+`
+	_, ems := parseEmbeds(t, src)
+	if len(ems) != 1 {
+		t.Fatalf("merge embeds error: %v", ems)
+	}
+	em := ems[0]
+	if strings.Join(em.Patterns, ",") != "testdata/data1.txt,testdata/data2.txt" {
+		t.Fatalf("merge patterns error: %v", em.Patterns)
+	}
+	if len(em.PatternPos) != 2 || em.PatternPos[0].Line != 5 || em.PatternPos[1].Line != 8 {
+		t.Fatalf("merge pattern pos error: %v", em.PatternPos)
+	}
+	// the position of the merged embed is the last directive
+	if em.Pos != em.PatternPos[1] {
+		t.Fatalf("merge pos error: %v", em.Pos)
+	}
+	testLoad(src, []*File{{"testdata/data1.txt", "hello data1"}, {"testdata/data2.txt", "hello data2"}}, t)
+}
+
+func TestErrorVarInsideFunc(t *testing.T) {
+	src := `package main
+
+import _ "embed"
+
+func main() {
+	//go:embed testdata/data1.txt
+	var data string
+	_ = data
+	_ = func() {
+
+		//go:embed testdata/data2.txt
+
+		var data2 string
+		_ = data2
+	}
+}
+`
+	testError(src, `./main.go:6:4: go:embed cannot apply to var inside func
+./main.go:11:5: go:embed cannot apply to var inside func`, t, withConfig(goembed.Config{AllErrors: true}))
+}
+
+func TestLoadBlankLine(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed testdata/data1.txt
+
+// data is the embedded files
+var data embed.FS
+
+var (
+	//go:embed testdata/data2.txt
+
+	data2 string
+)
+
+func main() {
+}
+`
+	testLoad(src, []*File{{"testdata/data1.txt", "hello data1"}, {"testdata/data2.txt", "hello data2"}}, t)
+}
+
 func TestErrorMultipleFiles(t *testing.T) {
 	src := `package main
 
@@ -370,3 +588,1159 @@ func main() {
 `
 	testLoad(src, []*File{{"testdata/two/data1.txt", "sub data1"}, {"testdata/two/data2.txt", "sub data2"}}, t)
 }
+
+func TestLoadHidden(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed testdata/all
+var data embed.FS
+
+func main() {
+}
+`
+	testLoad(src, []*File{{"testdata/all/data.txt", "hello all"}}, t)
+}
+
+func TestLoadAll(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed all:testdata/all
+var data embed.FS
+
+func main() {
+}
+`
+	testLoad(src, []*File{
+		{"testdata/all/.hidden.txt", "hello hidden"},
+		{"testdata/all/data.txt", "hello all"},
+		{"testdata/all/.well-known/security.txt", "hello well-known"},
+		{"testdata/all/_next/app.js", "hello next"},
+	}, t)
+}
+
+func TestErrorAllSyntax(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed all:../testdata
+var data embed.FS
+
+func main() {
+}
+`
+	testError(src, `./main.go:5:12: pattern all:../testdata: invalid pattern syntax`, t)
+}
+
+func TestLoadPackage(t *testing.T) {
+	pkg, err := goembed.LoadPackage(".", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Name != "goembed" || len(pkg.Embeds) != 0 {
+		t.Fatalf("load package error: %v %v", pkg.Name, pkg.Embeds)
+	}
+	pkg, err = goembed.LoadPackage(".", &goembed.LoadOptions{Tests: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, em := range pkg.Embeds {
+		names = append(names, em.Name)
+	}
+	if strings.Join(names, ",") != "data1,data2,fs,hashfs" {
+		t.Fatalf("load package embeds error: %v", names)
+	}
+	if files := pkg.EmbedFiles[pkg.Embeds[0]]; len(files) != 1 || string(files[0].Data) != "hello data1" {
+		t.Fatalf("load package data1 error: %v", files)
+	}
+	files := pkg.Files()
+	if len(files) != len(pkg.EmbedFiles[pkg.Embeds[2]])+len(pkg.EmbedFiles[pkg.Embeds[3]]) {
+		t.Fatalf("load package files error: %v", files)
+	}
+}
+
+func TestResolution(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed testdata/data1.txt testdata/two
+//go:embed testdata/*.txt
+var data embed.FS
+
+func main() {
+}
+`
+	_, ems := parseEmbeds(t, src)
+	wd, _ := os.Getwd()
+	res, err := goembed.NewResolve().Resolve(wd, ems[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(res.Files, ",") != "testdata/data1.txt,testdata/data2.txt,testdata/two/data1.txt,testdata/two/data2.txt" {
+		t.Fatalf("resolve files error: %v", res.Files)
+	}
+	pmap := map[string]string{
+		"testdata/data1.txt": "testdata/data1.txt",
+		"testdata/two":       "testdata/two/data1.txt,testdata/two/data2.txt",
+		"testdata/*.txt":     "testdata/data1.txt,testdata/data2.txt",
+	}
+	ppos := map[string]string{
+		"testdata/data1.txt": "./main.go:5:12",
+		"testdata/two":       "./main.go:5:31",
+		"testdata/*.txt":     "./main.go:6:12",
+	}
+	if len(res.PatternFiles) != len(pmap) || len(res.PatternPos) != len(ppos) {
+		t.Fatalf("resolve pattern error: %v %v", res.PatternFiles, res.PatternPos)
+	}
+	for pattern, files := range pmap {
+		if strings.Join(res.PatternFiles[pattern], ",") != files {
+			t.Fatalf("pattern %v: want %v, have %v", pattern, files, res.PatternFiles[pattern])
+		}
+		if pos := res.PatternPos[pattern]; len(pos) != 1 || pos[0].String() != ppos[pattern] {
+			t.Fatalf("pattern %v: want %v, have %v", pattern, ppos[pattern], pos)
+		}
+	}
+}
+
+func TestBuildEmbedCfg(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed testdata/data1.txt
+var data1 string
+
+//go:embed testdata/one testdata/data1.txt
+var fs embed.FS
+
+func main() {
+}
+`
+	_, ems := parseEmbeds(t, src)
+	data, err := goembed.BuildEmbedCfg(".", ems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct {
+		Patterns map[string][]string
+		Files    map[string]string
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Patterns) != 2 ||
+		strings.Join(cfg.Patterns["testdata/data1.txt"], ",") != "testdata/data1.txt" ||
+		strings.Join(cfg.Patterns["testdata/one"], ",") != "testdata/one/data.txt" {
+		t.Fatalf("embedcfg patterns error: %v", cfg.Patterns)
+	}
+	wd, _ := os.Getwd()
+	if len(cfg.Files) != 2 ||
+		cfg.Files["testdata/data1.txt"] != filepath.Join(wd, "testdata", "data1.txt") ||
+		cfg.Files["testdata/one/data.txt"] != filepath.Join(wd, "testdata", "one", "data.txt") {
+		t.Fatalf("embedcfg files error: %v", cfg.Files)
+	}
+	o, err := fsys.NewOverlay(wd, fsys.OverlayJSON{Replace: map[string]string{
+		"testdata/data1.txt": "testdata/data2.txt",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = goembed.BuildEmbedCfg(".", ems, goembed.WithOverlay(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Files["testdata/data1.txt"] != filepath.Join(wd, "testdata", "data2.txt") {
+		t.Fatalf("embedcfg overlay files error: %v", cfg.Files)
+	}
+	// the patterns are resolved in the io/fs tree, which has no disk paths
+	_, err = goembed.BuildEmbedCfg("pkg", ems, goembed.WithFS(fstest.MapFS{
+		"pkg/testdata/data1.txt":    {Data: []byte("hello data1")},
+		"pkg/testdata/one/data.txt": {Data: []byte("hello data")},
+	}))
+	if want := filepath.Join("pkg", "testdata", "data1.txt") + ": file system has no disk paths"; err == nil || err.Error() != want {
+		t.Fatalf("embedcfg must fail for io/fs files: %v, want %v", err, want)
+	}
+	mem, err := fsys.NewOverlay(wd, fsys.OverlayJSON{Contents: map[string][]byte{
+		"testdata/data1.txt": []byte("unsaved data1"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goembed.BuildEmbedCfg(".", ems, goembed.WithOverlay(mem)); err == nil || !strings.Contains(err.Error(), "not on disk") {
+		t.Fatalf("embedcfg must fail for in-memory contents: %v", err)
+	}
+	pkg, err := goembed.LoadPackage(".", &goembed.LoadOptions{Tests: true, Resolve: goembed.NewResolve(goembed.WithOverlay(o))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = pkg.EmbedCfg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Files = nil
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Files["testdata/data1.txt"] != filepath.Join(wd, "testdata", "data2.txt") {
+		t.Fatalf("package embedcfg overlay files error: %v", cfg.Files)
+	}
+}
+
+func TestErrorPatternPos(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed testdata/data1.txt
+//go:embed testdata/data2.txt testdata/none.txt
+//go:embed testdata/one
+var data embed.FS
+
+func main() {
+}
+`
+	testError(src, `./main.go:6:31: pattern testdata/none.txt: no matching files found`, t)
+}
+
+func TestErrorPatternPos2(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed "testdata/data1.txt" testdata/*.txt
+//go:embed testdata/[
+var data embed.FS
+
+func main() {
+}
+`
+	testError(src, `./main.go:6:12: pattern testdata/[: invalid pattern syntax`, t)
+}
+
+func TestAllErrors(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed testdata/data1.txt
+var data1 [10]byte
+
+//go:embed testdata/none.txt
+var data2 string
+
+//go:embed testdata/data1.txt testdata/[ testdata/one
+//go:embed testdata/none
+var data3 embed.FS
+
+//go:embed testdata/data1.txt
+//var data4 string
+
+//go:embed testdata/data2.txt
+var data5, data6 string
+
+//go:embed testdata/data2.txt
+var data7 string
+
+func main() {
+}
+`
+	files, err := load(src, withConfig(goembed.Config{AllErrors: true}), withResolve(goembed.WithAllErrors()))
+	want := []string{
+		`./main.go:6:5: go:embed cannot apply to var of type [10]byte`,
+		`./main.go:8:12: pattern testdata/none.txt: no matching files found`,
+		`./main.go:11:31: pattern testdata/[: invalid pattern syntax`,
+		`./main.go:12:12: pattern testdata/none: no matching files found`,
+		`./main.go:15:3: go:embed cannot apply to multiple vars`,
+	}
+	if err == nil || errorString(err) != strings.Join(want, "\n") {
+		t.Fatalf("have %v, want %v", err, want)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, ",") != "testdata/data1.txt,testdata/data2.txt,testdata/one/data.txt" {
+		t.Fatalf("load files error: %v", names)
+	}
+}
+
+func TestErrorFirstPosition(t *testing.T) {
+	src := `package main
+
+import _ "embed"
+
+//go:embed testdata/data1.txt
+
+func main() {
+}
+
+//go:embed testdata/data1.txt
+var data [10]byte
+`
+	want := "./main.go:5:3: misplaced go:embed directive"
+	testError(src, want, t)
+	testError(src, want+"\n./main.go:11:5: go:embed cannot apply to var of type [10]byte", t,
+		withConfig(goembed.Config{AllErrors: true}))
+}
+
+func TestAllErrorsImportName(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed testdata/data1.txt
+var data embed.FS
+`
+	fset := token.NewFileSet()
+	f, err := parserFile(fset, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eps, err := embedparser.ParseEmbed(fset, []*ast.File{f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Imports[0].Path.Value = `"embed`
+	conf := &goembed.Config{AllErrors: true}
+	ems, err := conf.CheckEmbed(eps.PatternPos, fset, []*ast.File{f})
+	if want := "./main.go:1:1: parser returned invalid quoted string: <\"embed>"; err == nil || errorString(err) != want {
+		t.Fatalf("\nwant %v\nhave %v", want, err)
+	}
+	if len(ems) != 0 {
+		t.Fatalf("check embeds error: %v", ems)
+	}
+}
+
+func TestLoadPackageAllErrors(t *testing.T) {
+	pkg, err := goembed.LoadPackage(".", &goembed.LoadOptions{Tests: true, AllErrors: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkg.Embeds) != 4 {
+		t.Fatalf("load package embeds error: %v", pkg.Embeds)
+	}
+}
+
+func TestTypesKind(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+type (
+	B  []byte
+	A  = []byte
+	S  string
+	MB byte
+	F  = embed.FS
+	F2 embed.FS
+)
+
+//go:embed testdata/data1.txt
+var b B
+
+//go:embed testdata/data1.txt
+var a A
+
+//go:embed testdata/data1.txt
+var s S
+
+//go:embed testdata/data1.txt
+var mb []MB
+
+//go:embed testdata/data1.txt
+var f F
+
+//go:embed testdata/data1.txt
+var f2 F2
+
+func main() {
+}
+`
+	fset := token.NewFileSet()
+	f, err := parserFile(fset, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eps, err := embedparser.ParseEmbed(fset, []*ast.File{f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	tconf := &types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := tconf.Check("main", fset, []*ast.File{f}, info); err != nil {
+		t.Fatal(err)
+	}
+	conf := &goembed.Config{AllErrors: true, Info: info}
+	ems, err := conf.CheckEmbed(eps.PatternPos, fset, []*ast.File{f})
+	if err == nil || err.Error() != "./main.go:30:5: go:embed cannot apply to var of type F2" {
+		t.Fatalf("check embed error: %v", err)
+	}
+	kinds := map[string]goembed.Kind{
+		"b":  goembed.EmbedBytes,
+		"a":  goembed.EmbedBytes,
+		"s":  goembed.EmbedString,
+		"mb": goembed.EmbedBytes,
+		"f":  goembed.EmbedFiles,
+	}
+	if len(ems) != len(kinds) {
+		t.Fatalf("check embed error: %v", ems)
+	}
+	for _, em := range ems {
+		if kinds[em.Name] != em.Kind {
+			t.Fatalf("%v: want kind %v, have %v", em.Name, kinds[em.Name], em.Kind)
+		}
+	}
+}
+
+func TestLoadPackageModuleVersion(t *testing.T) {
+	src := `package main
+
+import _ "embed"
+
+type S = string
+
+//go:embed data.txt
+var s S
+
+func main() {
+}
+`
+	dir := writeFiles(t, map[string]string{
+		"go.mod":       "module m\n\ngo 1.16\n",
+		"pkg/main.go":  src,
+		"pkg/data.txt": "data",
+	})
+	pkgdir := filepath.Join(dir, "pkg")
+	if v := goembed.ModuleGoVersion(pkgdir); v != "1.16" {
+		t.Fatalf("module go version error: %q", v)
+	}
+	want := "main.go:8:5: go:embed var of type S requires go1.17 or later (-lang was set to go1.16; check go.mod)"
+	if _, err := goembed.LoadPackage(pkgdir, nil); err == nil || !strings.HasSuffix(err.Error(), want) {
+		t.Fatalf("load package error: %v, want %v", err, want)
+	}
+	pkg, err := goembed.LoadPackage(pkgdir, &goembed.LoadOptions{TargetVersion: "1.17"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if em := pkg.Embeds[0]; em.Kind != goembed.EmbedMaybeAlias || string(pkg.EmbedFiles[em][0].Data) != "data" {
+		t.Fatalf("load package error: %v %v", em.Kind, pkg.EmbedFiles[em])
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module m\n\ngo 1.17 // comment\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goembed.LoadPackage(pkgdir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v := goembed.ModuleGoVersion(t.TempDir()); v != "" {
+		t.Fatalf("module go version error: %q", v)
+	}
+}
+
+func TestLoadFS(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed static *.txt
+var data embed.FS
+
+func main() {
+}
+`
+	fsys := fstest.MapFS{
+		"pkg/main.go":            {Data: []byte(src)},
+		"pkg/a.txt":              {Data: []byte("hello a")},
+		"pkg/static/b.txt":       {Data: []byte("hello b")},
+		"pkg/static/.hidden":     {Data: []byte("hidden")},
+		"pkg/static/mod/go.mod":  {Data: []byte("module mod")},
+		"pkg/static/mod/c.txt":   {Data: []byte("hello c")},
+		"pkg/static/sub/d.txt":   {Data: []byte("hello d")},
+		"other/static/other.txt": {Data: []byte("other")},
+	}
+	for _, dir := range []string{"pkg", "./pkg/"} {
+		testLoad(src, []*File{
+			{"a.txt", "hello a"},
+			{"static/b.txt", "hello b"},
+			{"static/sub/d.txt", "hello d"},
+		}, t, withDir(dir), withResolve(goembed.WithFS(fsys)))
+	}
+	testError(src, "./main.go:5:19: pattern *.txt: no matching files found", t, withDir("other"), withResolve(goembed.WithFS(fsys)))
+	src = `package main
+
+import "embed"
+
+//go:embed m
+var data embed.FS
+`
+	testError(src, "./main.go:5:12: pattern m: cannot embed directory m: in different module", t, withDir("."), withResolve(goembed.WithFS(fstest.MapFS{
+		"m/go.mod": {Data: []byte("module m")},
+		"m/a.txt":  {Data: []byte("hello a")},
+	})))
+}
+
+func TestLoadLazy(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed testdata
+var data embed.FS
+
+func main() {
+}
+`
+	fset, ems := parseEmbeds(t, src)
+	wd, _ := os.Getwd()
+	files, err := goembed.NewResolve().Load(wd, fset, ems[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazy, err := goembed.NewResolve(goembed.WithLazy()).Load(wd, fset, ems[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(lazy) {
+		t.Fatalf("load lazy error: %v", lazy)
+	}
+	for i, f := range lazy {
+		if f.Data != nil {
+			t.Fatalf("lazy file %v has data", f.Name)
+		}
+		if f.Name != files[i].Name || f.Hash != files[i].Hash || f.Size != files[i].Size || f.Size != int64(len(files[i].Data)) {
+			t.Fatalf("lazy file %v error: %v %v", f.Name, f, files[i])
+		}
+		data, err := f.ReadData()
+		if err != nil || string(data) != string(files[i].Data) {
+			t.Fatalf("lazy file %v read error: %q %v", f.Name, data, err)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(data) != string(files[i].Data) {
+			t.Fatalf("lazy file %v open error: %q %v", f.Name, data, err)
+		}
+	}
+	if err := fstest.TestFS(goembed.NewFS(lazy), "testdata/data1.txt", "testdata/one/data.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadFSLazyOpen(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed data.txt
+var data embed.FS
+
+func main() {
+}
+`
+	dir := writeFiles(t, map[string]string{"data.txt": "hello lazy"})
+	files, err := load(src, withDir(dir), withResolve(goembed.WithLazy()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := goembed.NewFS(files).Open("data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, ok := f.(io.ReaderAt); !ok {
+		t.Fatalf("lazy file must support ReadAt: %T", f)
+	}
+	// the data is read from the disk file after Open
+	if err := ioutil.WriteFile(filepath.Join(dir, "data.txt"), []byte("HELLO LAZY"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil || string(data) != "HELLO LAZY" {
+		t.Fatalf("lazy file not streamed: %q %v", data, err)
+	}
+	if info, err := f.Stat(); err != nil || info.Size() != int64(len("hello lazy")) {
+		t.Fatalf("lazy file stat error: %v %v", info, err)
+	}
+}
+
+func TestLoadParallel(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed testdata
+var data embed.FS
+
+func main() {
+}
+`
+	fset, ems := parseEmbeds(t, src)
+	wd, _ := os.Getwd()
+	files, err := goembed.NewResolve(goembed.WithWorkers(1)).Load(wd, fset, ems[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := goembed.NewResolve(goembed.WithWorkers(4))
+	var wg sync.WaitGroup
+	results := make([][]*goembed.File, 8)
+	errs := make([]error, len(results))
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = r.Load(wd, fset, ems[0])
+		}(i)
+	}
+	wg.Wait()
+	for i, list := range results {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if len(list) != len(files) {
+			t.Fatalf("load parallel error: %v", list)
+		}
+		for j, f := range list {
+			if f != results[0][j] {
+				t.Fatalf("load parallel %v not cached", f.Name)
+			}
+			if f.Name != files[j].Name || f.Hash != files[j].Hash || string(f.Data) != string(files[j].Data) {
+				t.Fatalf("load parallel file %v error: %v %v", f.Name, f, files[j])
+			}
+		}
+	}
+	if n := len(r.Files()); n != len(files) {
+		t.Fatalf("load parallel files %v, want %v", n, len(files))
+	}
+}
+
+func TestLoadCacheDir(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed data.txt
+var data embed.FS
+
+func main() {
+}
+`
+	fset, ems := parseEmbeds(t, src)
+	dir := writeFiles(t, map[string]string{"data.txt": "hello cache"})
+	cache := filepath.Join(dir, "cache")
+	fpath := filepath.Join(dir, "data.txt")
+	mtime := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(fpath, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	files, err := goembed.NewResolve(goembed.WithCacheDir(cache)).Load(dir, fset, ems[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256([]byte("hello cache"))
+	if !bytes.Equal(files[0].Hash[:], want[:16]) {
+		t.Fatalf("load cache hash error: %x", files[0].Hash)
+	}
+	entries, err := filepath.Glob(filepath.Join(cache, "[0-9a-f]*"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("load cache entries error: %v %v", entries, err)
+	}
+	// a cached hash is used without hashing the file again
+	fake := bytes.Repeat([]byte{1}, 16)
+	if err := ioutil.WriteFile(entries[0], fake, 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range [][]goembed.ResolveOption{
+		{goembed.WithCacheDir(cache)},
+		{goembed.WithCacheDir(cache), goembed.WithLazy()},
+	} {
+		files, err := goembed.NewResolve(opts...).Load(dir, fset, ems[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(files[0].Hash[:], fake) || files[0].Size != int64(len("hello cache")) {
+			t.Fatalf("load cache not used: %x %v", files[0].Hash, files[0].Size)
+		}
+	}
+	// a modified file is hashed again
+	if err := ioutil.WriteFile(fpath, []byte("hello cache!"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	files, err = goembed.NewResolve(goembed.WithCacheDir(cache), goembed.WithLazy()).Load(dir, fset, ems[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = sha256.Sum256([]byte("hello cache!"))
+	if !bytes.Equal(files[0].Hash[:], want[:16]) {
+		t.Fatalf("load cache modified hash error: %x", files[0].Hash)
+	}
+	// files of file systems without disk paths are not cached
+	fscache := filepath.Join(dir, "fscache")
+	_, err = goembed.NewResolve(goembed.WithCacheDir(fscache), goembed.WithFS(fstest.MapFS{
+		"pkg/data.txt": {Data: []byte("hello cache"), ModTime: mtime},
+	})).Load("pkg", fset, ems[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fscache); !os.IsNotExist(err) {
+		t.Fatalf("load cache must not cache io/fs files: %v", err)
+	}
+	// unused entries are trimmed
+	if err := os.Chtimes(fpath, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	for name, age := range map[string]time.Duration{"stale": 6 * 24 * time.Hour, "fresh": time.Hour, "trim.txt": 2 * 24 * time.Hour} {
+		fname := filepath.Join(cache, name)
+		if err := ioutil.WriteFile(fname, fake, 0666); err != nil {
+			t.Fatal(err)
+		}
+		used := time.Now().Add(-age)
+		if err := os.Chtimes(fname, used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := goembed.NewResolve(goembed.WithCacheDir(cache)).Load(dir, fset, ems[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(cache, "stale")); !os.IsNotExist(err) {
+		t.Fatalf("load cache stale entry not trimmed: %v", err)
+	}
+	for _, name := range []string{"fresh", "trim.txt"} {
+		if _, err := os.Stat(filepath.Join(cache, name)); err != nil {
+			t.Fatalf("load cache trim error: %v", err)
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed static
+var static embed.FS
+
+//go:embed data.txt
+var data string
+
+func main() {
+}
+`
+	fset, ems := parseEmbeds(t, src)
+	write := func(name, data string) {
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait := func(w *goembed.Watcher, want string) *goembed.WatchEvent {
+		select {
+		case ev := <-w.Events:
+			var names []string
+			for _, em := range ev.Embeds {
+				names = append(names, em.Name)
+			}
+			if strings.Join(names, ",") != want {
+				t.Fatalf("watch event error: %v %v, want %v", names, ev.Err, want)
+			}
+			return ev
+		case <-time.After(10 * time.Second):
+			t.Fatalf("watch event timeout, want %v", want)
+		}
+		return nil
+	}
+	for _, poll := range []bool{false, true} {
+		dir := writeFiles(t, map[string]string{"static/a.txt": "a", "data.txt": "data"})
+		w, err := goembed.NewWatcher(dir, fset, ems, &goembed.WatchOptions{
+			Poll:     poll,
+			Interval: 20 * time.Millisecond,
+			Debounce: 20 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		static := w.Files(ems[0])
+		if len(static) != 1 || string(static[0].Data) != "a" {
+			t.Fatalf("watch files error: %v", static)
+		}
+
+		write(filepath.Join(dir, "data.txt"), "data changed")
+		wait(w, "data")
+		if files := w.Files(ems[1]); len(files) != 1 || string(files[0].Data) != "data changed" {
+			t.Fatalf("watch data error: %v", files)
+		}
+		if files := w.Files(ems[0]); len(files) != 1 || files[0] != static[0] {
+			t.Fatalf("watch static not cached: %v", files)
+		}
+
+		write(filepath.Join(dir, "static", "sub", "b.txt"), "b")
+		wait(w, "static")
+		if files := w.Files(ems[0]); len(files) != 2 || files[0] != static[0] || files[1].Name != "static/sub/b.txt" {
+			t.Fatalf("watch static error: %v", files)
+		}
+
+		write(filepath.Join(dir, "static", "sub", "b.txt"), "b changed")
+		wait(w, "static")
+		if files := w.Files(ems[0]); len(files) != 2 || string(files[1].Data) != "b changed" {
+			t.Fatalf("watch static error: %v", files)
+		}
+
+		if err := os.Remove(filepath.Join(dir, "data.txt")); err != nil {
+			t.Fatal(err)
+		}
+		if ev := wait(w, "data"); ev.Err == nil {
+			t.Fatal("watch remove must fail")
+		}
+		// Close may be called more than once, also concurrently
+		var wg sync.WaitGroup
+		errs := make([]error, 3)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = w.Close()
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range append(errs, w.Close()) {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, ok := <-w.Events; ok {
+			t.Fatal("watch events not closed")
+		}
+	}
+}
+
+// walkFS counts the walks of a file system
+type walkFS struct {
+	resolve.FileSystem
+	mu    sync.Mutex
+	walks int
+}
+
+func (fs *walkFS) Walk(root string, fn filepath.WalkFunc) error {
+	fs.mu.Lock()
+	fs.walks++
+	fs.mu.Unlock()
+	return fs.FileSystem.Walk(root, fn)
+}
+
+func (fs *walkFS) count() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.walks
+}
+
+func TestWatcherWalk(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed static
+var static embed.FS
+
+func main() {
+}
+`
+	fset, ems := parseEmbeds(t, src)
+	dir := writeFiles(t, map[string]string{"static/a.txt": "a"})
+	if err := os.Mkdir(filepath.Join(dir, "static", "empty"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	fs := &walkFS{FileSystem: resolve.OS}
+	w, err := goembed.NewWatcher(dir, fset, ems, &goembed.WatchOptions{
+		Poll:           true,
+		Interval:       20 * time.Millisecond,
+		Debounce:       20 * time.Millisecond,
+		ResolveOptions: []goembed.ResolveOption{goembed.WithFileSystem(fs)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if n := fs.count(); n != 1 {
+		t.Fatalf("watch load walks %v times, want 1", n)
+	}
+	// the walked empty directory is watched
+	if err := ioutil.WriteFile(filepath.Join(dir, "static", "empty", "b.txt"), []byte("b"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-w.Events:
+		if ev.Err != nil || len(w.Files(ems[0])) != 2 {
+			t.Fatalf("watch event error: %v %v", ev.Err, w.Files(ems[0]))
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("watch event timeout")
+	}
+	if n := fs.count(); n != 2 {
+		t.Fatalf("watch rescan walks %v times, want 2", n)
+	}
+}
+
+func TestLoadOverlay(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed static
+var static embed.FS
+
+func main() {
+}
+`
+	dir := writeFiles(t, map[string]string{
+		"static/a.txt": "disk a",
+		"static/b.txt": "disk b",
+		"one.txt":      "overlay one",
+		"two.txt":      "overlay two",
+	})
+	o1, err := fsys.NewOverlay(dir, fsys.OverlayJSON{Replace: map[string]string{
+		"static/a.txt":   "one.txt",
+		"static/new.txt": "two.txt",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o2, err := fsys.NewOverlay(dir, fsys.OverlayJSON{Replace: map[string]string{
+		"static/a.txt": "two.txt",
+		"static/b.txt": "",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		o    *fsys.Overlay
+		want []*File
+	}{
+		{o1, []*File{{"static/a.txt", "overlay one"}, {"static/b.txt", "disk b"}, {"static/new.txt", "overlay two"}}},
+		{o2, []*File{{"static/a.txt", "overlay two"}}},
+		{&fsys.Overlay{}, []*File{{"static/a.txt", "disk a"}, {"static/b.txt", "disk b"}}},
+	} {
+		testLoad(src, test.want, t, withDir(dir), withResolve(goembed.WithOverlay(test.o)))
+	}
+}
+
+func TestLoadOverlayContents(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed static
+var static embed.FS
+
+func main() {
+}
+`
+	dir := writeFiles(t, map[string]string{"static/a.txt": "disk a"})
+	o, err := fsys.NewOverlay(dir, fsys.OverlayJSON{Contents: map[string][]byte{
+		"static/a.txt":     []byte("unsaved a"),
+		"static/mem/c.txt": []byte("unsaved c"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := o.Stat(filepath.Join(dir, "static", "mem", "c.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "c.txt" || info.Size() != int64(len("unsaved c")) || !info.Mode().IsRegular() || info.Mode().Perm() != 0444 {
+		t.Fatalf("overlay stat error: %v %v %v", info.Name(), info.Size(), info.Mode())
+	}
+	cpath := filepath.Join(dir, "static", "mem", "c.txt")
+	if _, err := o.Open(cpath); err == nil {
+		t.Fatal("overlay open must fail for in-memory contents")
+	}
+	f, err := o.OpenRead(cpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil || string(data) != "unsaved c" {
+		t.Fatalf("overlay read error: %q %v", data, err)
+	}
+	want := []*File{{"static/a.txt", "unsaved a"}, {"static/mem/c.txt", "unsaved c"}}
+	testLoad(src, want, t, withDir(dir), withResolve(goembed.WithOverlay(o)))
+	testLoad(src, want, t, withDir(dir), withResolve(goembed.WithOverlay(o), goembed.WithLazy()))
+	// the contents are copied, in-memory files are not deleted files
+	unsaved := []byte("package mem")
+	o2, err := fsys.NewOverlay(dir, fsys.OverlayJSON{
+		Replace:  map[string]string{"static/a.txt": ""},
+		Contents: map[string][]byte{"mem/main.go": unsaved},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(unsaved, "PACKAGE")
+	if data, err := resolve.ReadFile(resolve.FromOverlay(o2), filepath.Join(dir, "mem", "main.go")); err != nil || string(data) != "package mem" {
+		t.Fatalf("overlay contents not copied: %q %v", data, err)
+	}
+	if !o2.InMemory(filepath.Join(dir, "mem", "main.go")) || o2.InMemory(filepath.Join(dir, "static", "a.txt")) {
+		t.Fatal("overlay in-memory error")
+	}
+	if ok, err := o2.IsDirWithGoFiles(filepath.Join(dir, "mem")); !ok || err != nil {
+		t.Fatalf("overlay in-memory go files error: %v %v", ok, err)
+	}
+	for name, want := range map[string]string{
+		filepath.Join(dir, "mem", "main.go"):  "overlay contents are in memory, not on disk",
+		filepath.Join(dir, "static", "a.txt"): "file is deleted by the overlay",
+	} {
+		if _, err := resolve.DiskPath(resolve.FromOverlay(o2), name); err == nil || err.Error() != name+": "+want {
+			t.Fatalf("overlay disk path error: %v, want %v", err, want)
+		}
+	}
+	if _, err := fsys.NewOverlay(dir, fsys.OverlayJSON{
+		Replace:  map[string]string{"static/a.txt": ""},
+		Contents: map[string][]byte{"static/a.txt": nil},
+	}); err == nil {
+		t.Fatal("overlay must fail for a path in both Replace and Contents")
+	}
+}
+
+func TestLoadOverlayFile(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed testdata/_overlay/data.txt testdata/_overlay/new.txt
+var data embed.FS
+
+func main() {
+}
+`
+	wd, _ := os.Getwd()
+	o, err := fsys.ReadOverlay(wd, filepath.Join("testdata", "_overlay", "overlay.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*File{{"testdata/_overlay/data.txt", "hello overlay"}, {"testdata/_overlay/new.txt", "hello overlay"}}
+	testLoad(src, want, t, withResolve(goembed.WithOverlay(o)))
+	testLoad(src, want, t, withResolve(goembed.WithOverlay(o), goembed.WithLazy()))
+	_, ems := parseEmbeds(t, src)
+	cfg, err := goembed.BuildEmbedCfg(wd, ems, goembed.WithOverlay(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(cfg), "replace.txt") {
+		t.Fatalf("load overlay embedcfg error: %s", cfg)
+	}
+}
+
+// TestLoadOverlayDefault runs in a subprocess, because fsys.Init sets
+// the default overlay once for the process.
+func TestLoadOverlayDefault(t *testing.T) {
+	if os.Getenv("GOEMBED_TEST_OVERLAY_DEFAULT") != "1" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestLoadOverlayDefault$")
+		cmd.Env = append(os.Environ(), "GOEMBED_TEST_OVERLAY_DEFAULT=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		return
+	}
+	src := `package main
+
+import "embed"
+
+//go:embed testdata/_overlay/data.txt testdata/_overlay/new.txt
+var data embed.FS
+
+func main() {
+}
+`
+	wd, _ := os.Getwd()
+	fsys.OverlayFile = filepath.Join("testdata", "_overlay", "overlay.json")
+	if err := fsys.Init(wd); err != nil {
+		t.Fatal(err)
+	}
+	want := []*File{{"testdata/_overlay/data.txt", "hello overlay"}, {"testdata/_overlay/new.txt", "hello overlay"}}
+	testLoad(src, want, t)
+	testLoad(src, want, t, withResolve(goembed.WithLazy()))
+	_, ems := parseEmbeds(t, src)
+	cfg, err := goembed.BuildEmbedCfg(wd, ems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(cfg), "replace.txt") {
+		t.Fatalf("load overlay embedcfg error: %s", cfg)
+	}
+}
+
+func TestTargetVersion(t *testing.T) {
+	src := `package main
+
+import "embed"
+
+//go:embed all:testdata/all
+var data embed.FS
+
+func main() {
+}
+`
+	testError(src, "./main.go:5:3: go:embed requires go1.16 or later (-lang was set to go1.15; check go.mod)", t,
+		withConfig(goembed.Config{TargetVersion: "1.15"}))
+	testError(src, "./main.go:5:12: pattern all:testdata/all: all: prefix requires go1.18 or later (-lang was set to go1.17; check go.mod)", t,
+		withConfig(goembed.Config{TargetVersion: "1.17"}), withResolve(goembed.WithTargetVersion("1.17")))
+	fset, ems := parseEmbeds(t, src)
+	wd, _ := os.Getwd()
+	for _, test := range []struct {
+		version string
+		hash    goembed.HashKind
+	}{
+		{"1.18", goembed.HashSHA256},
+		{"1.21", goembed.HashNotSHA256},
+		{"go1.24", goembed.HashGo124},
+	} {
+		files, err := goembed.NewResolve(goembed.WithTargetVersion(test.version)).Load(wd, fset, ems[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, err := goembed.NewResolve(goembed.WithHash(test.hash)).Load(wd, fset, ems[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 4 || len(hash) != len(files) || files[0].Hash != hash[0].Hash {
+			t.Fatalf("target version %v error: %v", test.version, files)
+		}
+	}
+	// an explicit hash wins over the target version in any order
+	for _, opts := range [][]goembed.ResolveOption{
+		{goembed.WithHash(goembed.HashNone), goembed.WithTargetVersion("1.21")},
+		{goembed.WithTargetVersion("1.21"), goembed.WithHash(goembed.HashNone)},
+	} {
+		files, err := goembed.NewResolve(opts...).Load(wd, fset, ems[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files[0].Hash != [16]byte{} {
+			t.Fatalf("target version hash must not override WithHash: %x", files[0].Hash)
+		}
+	}
+	want := `invalid go version "go2"`
+	for _, opts := range [][]goembed.ResolveOption{
+		{goembed.WithTargetVersion("go2")},
+		{goembed.WithTargetVersion("go2"), goembed.WithAllErrors()},
+	} {
+		r := goembed.NewResolve(opts...)
+		if _, err := r.Load(wd, fset, ems[0]); err == nil || err.Error() != want {
+			t.Fatalf("load must fail for invalid version: %v", err)
+		}
+		if _, err := r.Resolve(wd, ems[0]); err == nil || err.Error() != want {
+			t.Fatalf("resolve must fail for invalid version: %v", err)
+		}
+	}
+}
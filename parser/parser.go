@@ -1,15 +1,17 @@
-//go:build go1.16
-// +build go1.16
-
 package parser
 
 import (
 	"fmt"
 	"go/ast"
+	"go/scanner"
 	"go/token"
 	"sort"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/visualfc/goembed/internal/goversion"
 )
 
 // EmbedPatterns is go:embed patterns and pos
@@ -18,11 +20,35 @@ type EmbedPatterns struct {
 	PatternPos map[string][]token.Position // line information for Patterns
 }
 
-// ParseEmbed parser go:embed patterns from files
+// Config is the configuration for parsing go:embed patterns
+type Config struct {
+	// TargetVersion is the Go version the files are parsed for, like
+	// the go directive of go.mod ("1.16" or "go1.16"). Empty is any
+	// version. Directives are reported as errors before go1.16.
+	TargetVersion string
+}
+
+// ParseEmbed parser go:embed patterns from files.
+// Malformed go:embed directives in all files are reported
+// as a scanner.ErrorList sorted by position.
 func ParseEmbed(fset *token.FileSet, files []*ast.File) (*EmbedPatterns, error) {
+	var conf Config
+	return conf.ParseEmbed(fset, files)
+}
+
+// ParseEmbed parser go:embed patterns from files with the configuration
+func (conf *Config) ParseEmbed(fset *token.FileSet, files []*ast.File) (*EmbedPatterns, error) {
+	minor := -1
+	if conf.TargetVersion != "" {
+		var ok bool
+		if minor, ok = goversion.Minor(conf.TargetVersion); !ok {
+			return nil, fmt.Errorf("invalid go version %q", conf.TargetVersion)
+		}
+	}
 	var embeds []fileEmbed
+	var errs scanner.ErrorList
 	for _, file := range files {
-		ems, err := parseFile(fset, file)
+		ems, err := parseFile(fset, file, minor, &errs)
 		if err != nil {
 			return nil, err
 		}
@@ -30,6 +56,10 @@ func ParseEmbed(fset *token.FileSet, files []*ast.File) (*EmbedPatterns, error)
 			embeds = append(embeds, ems...)
 		}
 	}
+	if len(errs) > 0 {
+		errs.Sort()
+		return nil, errs
+	}
 	if len(embeds) == 0 {
 		return nil, nil
 	}
@@ -40,7 +70,10 @@ func ParseEmbed(fset *token.FileSet, files []*ast.File) (*EmbedPatterns, error)
 	return &EmbedPatterns{embedPatterns(embedMap), embedMap}, nil
 }
 
-func parseFile(fset *token.FileSet, file *ast.File) ([]fileEmbed, error) {
+// parseFile parses the go:embed directives of file for the Go 1 minor
+// version, or any version if minor is negative.
+// Errors in the directives are added to errs.
+func parseFile(fset *token.FileSet, file *ast.File, minor int, errs *scanner.ErrorList) ([]fileEmbed, error) {
 	hasEmbed, err := haveEmbedImport(file)
 	if err != nil {
 		return nil, err
@@ -48,14 +81,21 @@ func parseFile(fset *token.FileSet, file *ast.File) ([]fileEmbed, error) {
 	var embeds []fileEmbed
 	for _, group := range file.Comments {
 		for _, comment := range group.List {
-			if strings.HasPrefix(comment.Text, "//go:embed ") {
+			if isGoEmbed(comment.Text) {
 				if !hasEmbed {
-					return nil, fmt.Errorf(`%v: go:embed only allowed in Go files that import "embed"`, fset.Position(comment.Slash+2))
+					errs.Add(fset.Position(comment.Slash+2), `go:embed only allowed in Go files that import "embed"`)
+					continue
+				}
+				if minor >= 0 && minor < 16 {
+					errs.Add(fset.Position(comment.Slash+2), fmt.Sprintf("go:embed requires go1.16 or later (-lang was set to go1.%d; check go.mod)", minor))
+					continue
 				}
-				embs, err := parseGoEmbed(comment.Text[11:], fset.Position(comment.Slash+11))
-				if err == nil {
-					embeds = append(embeds, embs...)
+				embs, err := parseGoEmbed(comment.Text[10:], fset.Position(comment.Slash+10))
+				if err != nil {
+					*errs = append(*errs, err.(*scanner.Error))
+					continue
 				}
+				embeds = append(embeds, embs...)
 			}
 		}
 	}
@@ -65,6 +105,16 @@ func parseFile(fset *token.FileSet, file *ast.File) ([]fileEmbed, error) {
 	return embeds, nil
 }
 
+// isGoEmbed reports whether text is a //go:embed directive:
+// "//go:embed" followed by a space or tab.
+func isGoEmbed(text string) bool {
+	if !strings.HasPrefix(text, "//go:embed") {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(text[10:])
+	return unicode.IsSpace(r)
+}
+
 func embedPatterns(m map[string][]token.Position) []string {
 	all := make([]string, 0, len(m))
 	for path := range m {
@@ -4,6 +4,7 @@ import (
 	"go/ast"
 	"go/build"
 	"go/parser"
+	"go/scanner"
 	"go/token"
 	"path/filepath"
 	"reflect"
@@ -48,3 +49,105 @@ func TestParser(t *testing.T) {
 		}
 	}
 }
+
+func TestParseEmbedPos(t *testing.T) {
+	src := "package main\n\nimport _ \"embed\"\n\n" +
+		"//go:embed a.txt  \"b c.txt\"\t`d.txt`\n" +
+		"//go:embed\t\"\\u00e9.txt\" é.txt f.txt\n" +
+		"var data string\n"
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	embed, err := embedparser.ParseEmbed(fset, []*ast.File{f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"a.txt":   "main.go:5:12",
+		"b c.txt": "main.go:5:19",
+		"d.txt":   "main.go:5:29",
+		"é.txt":   "main.go:6:12",
+		"f.txt":   "main.go:6:31",
+	}
+	if len(embed.PatternPos) != len(want) {
+		t.Fatalf("have %v, want %v", embed.PatternPos, want)
+	}
+	for pattern, pos := range want {
+		var have []string
+		for _, p := range embed.PatternPos[pattern] {
+			have = append(have, p.String())
+		}
+		if len(have) == 0 || have[0] != pos {
+			t.Fatalf("pattern %q: have %v, want %v", pattern, have, pos)
+		}
+	}
+	if n := len(embed.PatternPos["é.txt"]); n != 2 {
+		t.Fatalf("pattern é.txt: have %v positions, want 2", n)
+	}
+}
+
+func TestParseEmbedError(t *testing.T) {
+	src := "package main\n\nimport _ \"embed\"\n\n" +
+		"//go:embed a.txt \"b.txt\n" +
+		"var data1 string\n\n" +
+		"//go:embed `c.txt` \"\\q.txt\"\n" +
+		"var data2 string\n\n" +
+		"//go:embed \"d.txt\"e.txt\n" +
+		"var data3 string\n"
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = embedparser.ParseEmbed(fset, []*ast.File{f})
+	list, ok := err.(scanner.ErrorList)
+	if !ok {
+		t.Fatalf("have %v, want scanner.ErrorList", err)
+	}
+	want := []string{
+		`main.go:5:18: invalid quoted string in //go:embed: "b.txt`,
+		`main.go:8:20: invalid quoted string in //go:embed: "\q.txt"`,
+		`main.go:11:19: invalid quoted string in //go:embed: e.txt`,
+	}
+	if len(list) != len(want) {
+		t.Fatalf("have %v, want %v", list, want)
+	}
+	for i, e := range list {
+		if e.Error() != want[i] {
+			t.Fatalf("\nwant %v\nhave %v", want[i], e)
+		}
+	}
+}
+
+func TestParseEmbedTargetVersion(t *testing.T) {
+	src := "package main\n\nimport _ \"embed\"\n\n" +
+		"//go:embed a.txt\n" +
+		"var data1 string\n\n" +
+		"//go:embed b.txt\n" +
+		"var data2 string\n"
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &embedparser.Config{TargetVersion: "1.15"}
+	_, err = conf.ParseEmbed(fset, []*ast.File{f})
+	want := "main.go:5:3: go:embed requires go1.16 or later (-lang was set to go1.15; check go.mod) (and 1 more errors)"
+	if err == nil || err.Error() != want {
+		t.Fatalf("\nwant %v\nhave %v", want, err)
+	}
+	conf.TargetVersion = "go1.16"
+	eps, err := conf.ParseEmbed(fset, []*ast.File{f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(eps.Patterns, []string{"a.txt", "b.txt"}) {
+		t.Fatalf("parse embed error: %v", eps.Patterns)
+	}
+	conf.TargetVersion = "go1"
+	if _, err := conf.ParseEmbed(fset, []*ast.File{f}); err == nil {
+		t.Fatal("parse embed must fail for invalid version")
+	}
+}
@@ -2,50 +2,196 @@ package goembed
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"fmt"
 	"go/printer"
+	"go/scanner"
 	"go/token"
+	"io"
 	"io/ioutil"
 	"path"
 	"path/filepath"
+	"runtime"
 	"sort"
+	"strings"
+	"sync"
 
+	"github.com/visualfc/goembed/fsys"
 	"github.com/visualfc/goembed/resolve"
 )
 
 // File is embed data info
 type File struct {
 	Name string
-	Data []byte
-	Hash [16]byte // truncated SHA256 hash
+	Data []byte   // nil for lazy files, use Open or ReadData
+	Hash [16]byte // truncated hash, see HashKind
+	Size int64    // size of the file data, also known for lazy files
+
+	open func() (io.ReadCloser, error) // opener of lazy file
+}
+
+// Open opens the file data for reading. The data of lazy files
+// is streamed from the file system.
+func (f *File) Open() (io.ReadCloser, error) {
+	if f.open == nil {
+		return ioutil.NopCloser(bytes.NewReader(f.Data)), nil
+	}
+	return f.open()
+}
+
+// ReadData returns the file data. The data of lazy files is read
+// from the file system and not kept by the file.
+func (f *File) ReadData() ([]byte, error) {
+	if f.open == nil {
+		return f.Data, nil
+	}
+	rc, err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// size returns the data size of the file
+func (f *File) size() int64 {
+	if f.open == nil {
+		return int64(len(f.Data))
+	}
+	return f.Size
+}
+
+// Resolution is the resolved go:embed patterns of Embed
+type Resolution struct {
+	Files        []string                    // unique matched files, sorted
+	PatternFiles map[string][]string         // pattern -> matched files
+	PatternPos   map[string][]token.Position // pattern -> positions
 }
 
 // Resolve is load embed data interface
 type Resolve interface {
+	Resolve(dir string, em *Embed) (*Resolution, error)
 	Load(dir string, fset *token.FileSet, em *Embed) ([]*File, error)
 	Files() []*File
 }
 
 type resolveFile struct {
-	data map[string]*File
+	mu        sync.Mutex
+	data      map[string]*File
+	fsys      resolve.FileSystem
+	allErrors bool
+	lazy      bool
+	workers   int
+	cache     *hashCache
+	hash      HashKind
+	hashSet   bool // hash set by WithHash
+	target    string
+	err       error // error of the options, returned by Resolve
 }
 
-// NewResolve create load embed data interface
-func NewResolve() Resolve {
-	return &resolveFile{make(map[string]*File)}
+// ResolveOption is option of NewResolve
+type ResolveOption func(r *resolveFile)
+
+// WithAllErrors reports all errors of Resolve and Load as a scanner.ErrorList
+// sorted by position, and returns the valid results together with the errors.
+func WithAllErrors() ResolveOption {
+	return func(r *resolveFile) {
+		r.allErrors = true
+	}
+}
+
+// WithLazy loads files without keeping their data in memory: the hash
+// is computed by streaming the file, and the data is read only by
+// File.Open and File.ReadData.
+func WithLazy() ResolveOption {
+	return func(r *resolveFile) {
+		r.lazy = true
+	}
+}
+
+// WithWorkers sets the maximum number of files read and hashed in parallel
+// by Load. The default is runtime.GOMAXPROCS(0).
+func WithWorkers(n int) ResolveOption {
+	return func(r *resolveFile) {
+		r.workers = n
+	}
+}
+
+// WithHash sets the hash kind of File.Hash. The default is HashSHA256.
+// Use ToolchainHash to match the hashes of the embed.FS files compiled
+// by a Go toolchain. It takes precedence over WithTargetVersion.
+func WithHash(kind HashKind) ResolveOption {
+	return func(r *resolveFile) {
+		r.hash = kind
+		r.hashSet = true
+	}
 }
 
-// BuildFS is build files to new files list with directory
+// WithTargetVersion resolves the patterns for the Go version, like the
+// go directive of go.mod ("1.16" or "go1.16"), and sets the hash kind
+// to the toolchain hash of the version, unless set by WithHash in any
+// order. An invalid version is reported by Resolve and Load.
+func WithTargetVersion(version string) ResolveOption {
+	return func(r *resolveFile) {
+		r.target = version
+		hash, err := ToolchainHash(version)
+		if err != nil {
+			r.err = err
+			return
+		}
+		if !r.hashSet {
+			r.hash = hash
+		}
+	}
+}
+
+// WithCacheDir caches the hashes of the loaded files in dir, keyed by
+// the disk path, size, modification time and inode of each file. Files
+// with a cached hash are not hashed again, and in lazy mode not read at
+// all. Files modified in the last two seconds, files of file systems
+// without disk paths and in-memory overlay contents are not cached.
+// Entries unused for five days are removed from dir.
+func WithCacheDir(dir string) ResolveOption {
+	return func(r *resolveFile) {
+		r.cache = &hashCache{dir: dir}
+	}
+}
+
+// WithFileSystem resolves and reads the embed files from fsys
+// instead of the OS file system.
+func WithFileSystem(fsys resolve.FileSystem) ResolveOption {
+	return func(r *resolveFile) {
+		r.fsys = fsys
+	}
+}
+
+// WithOverlay resolves and reads the embed files from the OS file
+// system with the overlay o.
+func WithOverlay(o *fsys.Overlay) ResolveOption {
+	return WithFileSystem(resolve.FromOverlay(o))
+}
+
+// NewResolve create load embed data interface.
+// The Resolve is safe for concurrent use.
+func NewResolve(opts ...ResolveOption) Resolve {
+	r := &resolveFile{data: make(map[string]*File), fsys: resolve.OS, workers: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// BuildFS is build files to new files list with directory.
+// The directory entries already in files are kept.
 func BuildFS(files []*File) []*File {
 	have := make(map[string]bool)
 	var list []*File
 	for _, file := range files {
-		if !have[file.Name] {
-			have[file.Name] = true
+		name := strings.TrimSuffix(file.Name, "/")
+		if !have[name] {
+			have[name] = true
 			list = append(list, file)
 		}
-		for dir := path.Dir(file.Name); dir != "." && !have[dir]; dir = path.Dir(dir) {
+		for dir := path.Dir(name); dir != "." && !have[dir]; dir = path.Dir(dir) {
 			have[dir] = true
 			list = append(list, &File{Name: dir + "/"})
 		}
@@ -57,52 +203,266 @@ func BuildFS(files []*File) []*File {
 }
 
 func (r *resolveFile) Files() (files []*File) {
+	r.mu.Lock()
 	for _, v := range r.data {
 		files = append(files, v)
 	}
+	r.mu.Unlock()
 	sort.Slice(files, func(i, j int) bool {
 		return embedFileLess(files[i].Name, files[j].Name)
 	})
 	return
 }
 
+func (r *resolveFile) Resolve(dir string, em *Embed) (*Resolution, error) {
+	return r.resolve(dir, em, nil)
+}
+
+// resolve resolves em like Resolve, calling visitDir for the walked
+// directories if not nil, see resolve.Resolver.VisitDir.
+func (r *resolveFile) resolve(dir string, em *Embed, visitDir func(dir string)) (*Resolution, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	rv := &resolve.Resolver{FS: r.fsys, AllErrors: r.allErrors, TargetVersion: r.target, VisitDir: visitDir}
+	files, pmap, err := rv.Resolve(dir, em.Patterns)
+	if err != nil {
+		err = em.patternError(err)
+		if !r.allErrors {
+			return nil, err
+		}
+		err = appendError(nil, err)
+	}
+	ppos := make(map[string][]token.Position)
+	for i, pattern := range em.Patterns {
+		if i < len(em.PatternPos) {
+			ppos[pattern] = append(ppos[pattern], em.PatternPos[i])
+		}
+	}
+	return &Resolution{Files: files, PatternFiles: pmap, PatternPos: ppos}, err
+}
+
+// pattern returns the first pattern that matched file.
+func (r *Resolution) pattern(file string) string {
+	var patterns []string
+	for pattern := range r.PatternFiles {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		for _, f := range r.PatternFiles[pattern] {
+			if f == file {
+				return pattern
+			}
+		}
+	}
+	return ""
+}
+
 func (r *resolveFile) Load(dir string, fset *token.FileSet, em *Embed) ([]*File, error) {
-	list, err := resolve.ResolveEmbed(dir, em.Patterns)
+	return r.load(dir, fset, em, nil)
+}
+
+// load loads em like Load, calling visitDir for the walked
+// directories if not nil, see resolve.Resolver.VisitDir.
+func (r *resolveFile) load(dir string, fset *token.FileSet, em *Embed, visitDir func(dir string)) ([]*File, error) {
+	var errs scanner.ErrorList
+	res, err := r.resolve(dir, em, visitDir)
 	if err != nil {
-		return nil, fmt.Errorf("%v: %w", em.Pos, err)
+		if !r.allErrors || res == nil {
+			return nil, err
+		}
+		errs = appendError(errs, err)
+	}
+	list := make([]*File, len(res.Files))
+	listErr := make([]error, len(res.Files))
+	var todo []int
+	r.mu.Lock()
+	for i, v := range res.Files {
+		if f, ok := r.data[filepath.Join(dir, v)]; ok {
+			list[i] = f
+		} else {
+			todo = append(todo, i)
+		}
 	}
+	r.mu.Unlock()
+	r.parallel(len(todo), func(n int) {
+		i := todo[n]
+		fpath := filepath.Join(dir, res.Files[i])
+		f, err := r.loadFile(res.Files[i], fpath)
+		if err != nil {
+			listErr[i] = err
+			return
+		}
+		r.mu.Lock()
+		if v, ok := r.data[fpath]; ok {
+			f = v
+		} else {
+			r.data[fpath] = f
+		}
+		r.mu.Unlock()
+		list[i] = f
+	})
 	var files []*File
-	for _, v := range list {
-		fpath := filepath.Join(dir, v)
-		f, ok := r.data[fpath]
-		if !ok {
-			data, err := ioutil.ReadFile(fpath)
-			if err != nil {
-				return nil, fmt.Errorf("%v: embed %v: %w", em.Pos, em.Patterns, err)
+	for i, f := range list {
+		if err := listErr[i]; err != nil {
+			err = em.patternError(&resolve.EmbedError{Pattern: res.pattern(res.Files[i]), Err: err})
+			if !r.allErrors {
+				return nil, err
 			}
-			f = &File{
-				Name: v,
-				Data: data,
-			}
-			if len(data) > 0 {
-				hash := sha256.Sum256(data)
-				copy(f.Hash[:], hash[:16])
-			}
-			r.data[fpath] = f
+			errs = appendError(errs, err)
+			continue
 		}
 		files = append(files, f)
 	}
 	if em.Kind != EmbedFiles && len(files) > 1 {
 		var buf bytes.Buffer
 		printer.Fprint(&buf, fset, em.Spec.Type)
-		return nil, fmt.Errorf("%v: invalid go:embed: multiple files for type %v", fset.Position(em.Spec.Names[0].NamePos), buf.String())
+		pos := fset.Position(em.Spec.Names[0].NamePos)
+		msg := fmt.Sprintf("invalid go:embed: multiple files for type %v", buf.String())
+		if !r.allErrors {
+			return nil, fmt.Errorf("%v: %v", pos, msg)
+		}
+		errs.Add(pos, msg)
+		files = nil
 	}
 	sort.Slice(files, func(i, j int) bool {
 		return embedFileLess(files[i].Name, files[j].Name)
 	})
+	if len(errs) > 0 {
+		errs.Sort()
+		return files, errs
+	}
 	return files, nil
 }
 
+// parallel calls fn for 0 to n-1 with at most r.workers goroutines
+func (r *resolveFile) parallel(n int, fn func(i int)) {
+	workers := r.workers
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	ch := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ch {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		ch <- i
+	}
+	close(ch)
+	wg.Wait()
+}
+
+// loadFile loads the file fpath as name, using the hash cache if any.
+func (r *resolveFile) loadFile(name, fpath string) (*File, error) {
+	if r.cache == nil {
+		return r.readFile(name, fpath, nil)
+	}
+	info, err := r.fsys.Stat(fpath)
+	if err != nil {
+		return nil, err
+	}
+	disk, err := resolve.DiskPath(r.fsys, fpath)
+	if err != nil {
+		return r.readFile(name, fpath, nil)
+	}
+	key := r.cache.key(disk, info, r.hash)
+	if key == "" {
+		return r.readFile(name, fpath, nil)
+	}
+	if hash, ok := r.cache.get(key); ok {
+		if r.lazy {
+			return &File{Name: name, Hash: hash, Size: info.Size(), open: r.opener(fpath)}, nil
+		}
+		f, err := r.readFile(name, fpath, &hash)
+		if err != nil || f.Size == info.Size() {
+			return f, err
+		}
+	}
+	f, err := r.readFile(name, fpath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.Size == info.Size() {
+		r.cache.put(key, f.Hash)
+	}
+	return f, nil
+}
+
+// opener returns the opener of the lazy file fpath
+func (r *resolveFile) opener(fpath string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return r.fsys.Open(fpath)
+	}
+}
+
+// readFile reads the file fpath as name. If hash is not nil, it is
+// used as the hash of the file data instead of computing it.
+func (r *resolveFile) readFile(name, fpath string, hash *[16]byte) (*File, error) {
+	if r.lazy {
+		rc, err := r.fsys.Open(fpath)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		f := &File{Name: name, open: r.opener(fpath)}
+		f.Hash, f.Size, err = r.hash.sum(rc)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	data, err := resolve.ReadFile(r.fsys, fpath)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{
+		Name: name,
+		Data: data,
+		Size: int64(len(data)),
+	}
+	if hash != nil {
+		f.Hash = *hash
+	} else {
+		f.Hash = r.hash.sumData(data)
+	}
+	return f, nil
+}
+
+// appendError appends err to list, keeping the positions of
+// scanner and resolve errors.
+func appendError(list scanner.ErrorList, err error) scanner.ErrorList {
+	switch err := err.(type) {
+	case scanner.ErrorList:
+		return append(list, err...)
+	case *scanner.Error:
+		return append(list, err)
+	case resolve.ErrorList:
+		for _, e := range err {
+			list.Add(e.Pos, fmt.Sprintf("pattern %s: %v", e.Pattern, e.Err))
+		}
+		return list
+	case *resolve.EmbedError:
+		list.Add(err.Pos, fmt.Sprintf("pattern %s: %v", err.Pattern, err.Err))
+		return list
+	}
+	list.Add(token.Position{}, err.Error())
+	return list
+}
+
 func embedFileNameSplit(name string) (dir, elem string, isDir bool) {
 	if name[len(name)-1] == '/' {
 		isDir = true
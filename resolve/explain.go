@@ -0,0 +1,46 @@
+package resolve
+
+import (
+	"fmt"
+)
+
+// A Candidate is a path considered by a //go:embed pattern.
+type Candidate struct {
+	Path     string // slash-separated path relative to the package directory
+	Included bool   // whether the file is embedded
+	Reason   string // why the path is included or excluded
+}
+
+func (c Candidate) String() string {
+	if c.Included {
+		return fmt.Sprintf("include %s: %s", c.Path, c.Reason)
+	}
+	return fmt.Sprintf("exclude %s: %s", c.Path, c.Reason)
+}
+
+// Explain resolves the //go:embed pattern in dir like ResolveEmbed,
+// and returns every path the pattern matched or walked with its verdict.
+// Unlike ResolveEmbed, a file that cannot be embedded is reported as an
+// excluded candidate instead of failing the pattern. The error is the
+// error of the pattern itself, like invalid syntax or no matching files.
+func Explain(dir string, pattern string) ([]Candidate, error) {
+	var r Resolver
+	return r.Explain(dir, pattern)
+}
+
+// Explain is like the Explain function but uses the configuration of r.
+func (r *Resolver) Explain(dir string, pattern string) ([]Candidate, error) {
+	rv, err := r.newResolver(dir)
+	if err != nil {
+		return nil, err
+	}
+	var list []Candidate
+	rv.pid = 1
+	rv.explain = func(c Candidate) {
+		list = append(list, c)
+	}
+	if _, err := rv.resolvePattern(pattern); err != nil {
+		return list, &EmbedError{Pattern: pattern, Err: err}
+	}
+	return list, nil
+}
@@ -0,0 +1,109 @@
+package resolve
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes the slash-separated files to a temporary
+// directory and returns the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		fpath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// explainString returns the candidates one per line
+func explainString(list []Candidate) string {
+	var info []string
+	for _, c := range list {
+		info = append(info, c.String())
+	}
+	return strings.Join(info, "\n")
+}
+
+func TestExplain(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"static/a.txt":       "a",
+		"static/.hidden":     "hidden",
+		"static/_tmp/x.txt":  "x",
+		"static/.git/config": "config",
+		"static/sub/go.mod":  "module sub",
+		"static/sub/b.txt":   "b",
+	})
+	if err := os.Symlink("a.txt", filepath.Join(dir, "static", "link")); err != nil {
+		t.Skip(err)
+	}
+	list, err := Explain(dir, "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"exclude static/.git: version control directory",
+		"exclude static/.hidden: hidden name begins with . or _, use the all: prefix to embed it",
+		"exclude static/_tmp: hidden name begins with . or _, use the all: prefix to embed it",
+		"include static/a.txt: in directory static",
+		"exclude static/link: symbolic link",
+		"exclude static/sub: directory in different module, contains go.mod",
+	}, "\n")
+	if have := explainString(list); have != want {
+		t.Fatalf("explain error:\n%v\nwant\n%v", have, want)
+	}
+	list, err = Explain(dir, "static/sub/b.txt")
+	if err == nil || err.Error() != "pattern static/sub/b.txt: no matching files found" {
+		t.Fatalf("explain error: %v", err)
+	}
+	if len(list) != 1 || list[0].String() != "exclude static/sub/b.txt: cannot embed file static/sub/b.txt: in different module" {
+		t.Fatalf("explain error: %v", list)
+	}
+}
+
+// emptyNameFS is the OS file system, but walks the files named
+// empty.txt with an empty name.
+type emptyNameFS struct {
+	FileSystem
+}
+
+type emptyNameInfo struct {
+	fs.FileInfo
+}
+
+func (emptyNameInfo) Name() string { return "" }
+
+func (e emptyNameFS) Walk(root string, fn filepath.WalkFunc) error {
+	return e.FileSystem.Walk(root, func(path string, info fs.FileInfo, err error) error {
+		if info != nil && info.Name() == "empty.txt" {
+			info = emptyNameInfo{info}
+		}
+		return fn(path, info, err)
+	})
+}
+
+func TestExplainEmptyName(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"static/a.txt":     "a",
+		"static/empty.txt": "empty",
+	})
+	r := &Resolver{FS: emptyNameFS{OS}}
+	list, err := r.Explain(dir, "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "include static/a.txt: in directory static\nexclude static/empty.txt: empty name"
+	if have := explainString(list); have != want {
+		t.Fatalf("explain error:\n%v\nwant\n%v", have, want)
+	}
+}
@@ -0,0 +1,94 @@
+package resolve
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/visualfc/goembed/fs"
+	"github.com/visualfc/goembed/fsys"
+)
+
+// FileSystem is the file system used to resolve //go:embed patterns
+// and read the embedded files. Paths use the OS separator.
+type FileSystem interface {
+	Glob(pattern string) ([]string, error)
+	Lstat(name string) (fs.FileInfo, error)
+	Stat(name string) (fs.FileInfo, error)
+	Walk(root string, fn filepath.WalkFunc) error
+	Open(name string) (io.ReadCloser, error)
+}
+
+// OS is the OS file system with the fsys overlay, the default FileSystem.
+var OS FileSystem = osFS{}
+
+type osFS struct{}
+
+func (osFS) Glob(pattern string) ([]string, error)        { return fsys.Glob(pattern) }
+func (osFS) Lstat(name string) (fs.FileInfo, error)       { return fsys.Lstat(name) }
+func (osFS) Stat(name string) (fs.FileInfo, error)        { return fsys.Stat(name) }
+func (osFS) Walk(root string, fn filepath.WalkFunc) error { return fsys.Walk(root, fn) }
+func (osFS) Open(name string) (io.ReadCloser, error)      { return fsys.OpenRead(name) }
+
+// FromOverlay returns the OS file system with the overlay o.
+func FromOverlay(o *fsys.Overlay) FileSystem {
+	return overlayFS{o}
+}
+
+type overlayFS struct {
+	o *fsys.Overlay
+}
+
+func (f overlayFS) Glob(pattern string) ([]string, error)        { return f.o.Glob(pattern) }
+func (f overlayFS) Lstat(name string) (fs.FileInfo, error)       { return f.o.Lstat(name) }
+func (f overlayFS) Stat(name string) (fs.FileInfo, error)        { return f.o.Stat(name) }
+func (f overlayFS) Walk(root string, fn filepath.WalkFunc) error { return f.o.Walk(root, fn) }
+func (f overlayFS) Open(name string) (io.ReadCloser, error)      { return f.o.OpenRead(name) }
+
+// ReadFile reads the file name from fsys.
+func ReadFile(fsys FileSystem, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// IsOS reports whether sys reads the OS file system, so that its
+// paths are OS paths like those of OS and FromOverlay.
+func IsOS(sys FileSystem) bool {
+	return overlayOf(sys) != nil
+}
+
+// overlayOf returns the overlay of the OS file system sys, or nil
+// if sys is not an OS file system.
+func overlayOf(sys FileSystem) *fsys.Overlay {
+	switch f := sys.(type) {
+	case osFS:
+		return fsys.Default()
+	case overlayFS:
+		return f.o
+	}
+	return nil
+}
+
+// DiskPath returns the path on disk of the contents of the file name in
+// sys, as needed by the -embedcfg file of go tool compile. It is an
+// error if sys has no disk paths, like the file systems of FromFS, or
+// if the overlay of sys deletes the file or holds its contents in memory.
+func DiskPath(sys FileSystem, name string) (string, error) {
+	o := overlayOf(sys)
+	if o == nil {
+		return "", fmt.Errorf("%s: file system has no disk paths", name)
+	}
+	if o.InMemory(name) {
+		return "", fmt.Errorf("%s: overlay contents are in memory, not on disk", name)
+	}
+	p, _ := o.OverlayPath(name)
+	if p == "" {
+		return "", fmt.Errorf("%s: file is deleted by the overlay", name)
+	}
+	return p, nil
+}
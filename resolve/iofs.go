@@ -0,0 +1,62 @@
+//go:build go1.16
+// +build go1.16
+
+package resolve
+
+import (
+	"io"
+	iofs "io/fs"
+	"path"
+	"path/filepath"
+
+	"github.com/visualfc/goembed/fs"
+)
+
+// FromFS returns a FileSystem reading from fsys. The OS paths passed to
+// it, including the package directory, are taken as slash-separated
+// names relative to the root of fsys. Lstat does not see symbolic links,
+// since io/fs has no such notion.
+func FromFS(fsys iofs.FS) FileSystem {
+	return ioFS{fsys}
+}
+
+type ioFS struct {
+	fsys iofs.FS
+}
+
+func (f ioFS) name(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+func (f ioFS) Glob(pattern string) ([]string, error) {
+	matches, err := iofs.Glob(f.fsys, f.name(pattern))
+	for i, m := range matches {
+		matches[i] = filepath.FromSlash(m)
+	}
+	return matches, err
+}
+
+func (f ioFS) Lstat(name string) (fs.FileInfo, error) {
+	return iofs.Stat(f.fsys, f.name(name))
+}
+
+func (f ioFS) Stat(name string) (fs.FileInfo, error) {
+	return iofs.Stat(f.fsys, f.name(name))
+}
+
+func (f ioFS) Walk(root string, fn filepath.WalkFunc) error {
+	return iofs.WalkDir(f.fsys, f.name(root), func(name string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return fn(filepath.FromSlash(name), nil, err)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fn(filepath.FromSlash(name), nil, err)
+		}
+		return fn(filepath.FromSlash(name), info, nil)
+	})
+}
+
+func (f ioFS) Open(name string) (io.ReadCloser, error) {
+	return f.fsys.Open(f.name(name))
+}
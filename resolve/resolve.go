@@ -7,22 +7,29 @@ package resolve
 import (
 	"encoding/json"
 	"fmt"
+	"go/token"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/visualfc/goembed/fs"
-	"github.com/visualfc/goembed/fsys"
+	"github.com/visualfc/goembed/internal/goversion"
 )
 
 // An EmbedError indicates a problem with a go:embed directive.
+// Pos is the position of the pattern, if known.
 type EmbedError struct {
 	Pattern string
+	Pos     token.Position
 	Err     error
 }
 
 func (e *EmbedError) Error() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("%v: pattern %s: %v", e.Pos, e.Pattern, e.Err)
+	}
 	return fmt.Sprintf("pattern %s: %v", e.Pattern, e.Err)
 }
 
@@ -36,148 +43,344 @@ func (e *EmbedError) Unwrap() error {
 // TODO(#42504): Once go mod vendor uses load.PackagesAndErrors, just
 // call (*Package).ResolveEmbed
 func ResolveEmbed(dir string, patterns []string) ([]string, error) {
-	files, _, err := resolveEmbed(dir, patterns)
+	files, _, err := resolveEmbed(&Resolver{}, dir, patterns)
 	return files, err
 }
 
+// ResolveEmbedMap resolves //go:embed patterns and returns the unique
+// file list and the mapping from each pattern to the files it matched.
+func ResolveEmbedMap(dir string, patterns []string) (files []string, pmap map[string][]string, err error) {
+	return resolveEmbed(&Resolver{}, dir, patterns)
+}
+
+// A Resolver resolves //go:embed patterns.
+type Resolver struct {
+	// FS is the file system to resolve the patterns in.
+	// If FS is nil, the OS file system with the fsys overlay is used.
+	FS FileSystem
+
+	// AllErrors makes Resolve check every pattern and report all
+	// errors as an ErrorList, instead of stopping at the first one.
+	// The files matched by the valid patterns are returned as well.
+	AllErrors bool
+
+	// TargetVersion is the Go version the patterns are resolved for,
+	// like the go directive of go.mod ("1.16" or "go1.16"). Empty is
+	// any version. The all: prefix is an error before go1.18.
+	TargetVersion string
+
+	// VisitDir, if set, is called with the path of every directory
+	// walked by the patterns, like the directories to watch for new files.
+	VisitDir func(dir string)
+}
+
+// Resolve is like ResolveEmbedMap but uses the configuration of r.
+func (r *Resolver) Resolve(dir string, patterns []string) (files []string, pmap map[string][]string, err error) {
+	return resolveEmbed(r, dir, patterns)
+}
+
+// newResolver returns the resolver of the configuration r for pkgdir
+func (r *Resolver) newResolver(pkgdir string) (*resolver, error) {
+	fsys := r.FS
+	if fsys == nil {
+		fsys = OS
+	}
+	minor := -1
+	if r.TargetVersion != "" {
+		var ok bool
+		if minor, ok = goversion.Minor(r.TargetVersion); !ok {
+			return nil, fmt.Errorf("invalid go version %q", r.TargetVersion)
+		}
+	}
+	return &resolver{
+		fsys:   fsys,
+		pkgdir: filepath.Clean(pkgdir),
+		have:   make(map[string]int),
+		dirOK:  make(map[string]bool),
+		minor:  minor,
+		visit:  r.VisitDir,
+	}, nil
+}
+
+// An ErrorList is a list of *EmbedErrors.
+type ErrorList []*EmbedError
+
+func (p ErrorList) Error() string {
+	switch len(p) {
+	case 0:
+		return "no errors"
+	case 1:
+		return p[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", p[0], len(p)-1)
+}
+
 // resolveEmbed resolves //go:embed patterns to precise file lists.
 // It sets files to the list of unique files matched (for go list),
 // and it sets pmap to the more precise mapping from
-// patterns to files.
-func resolveEmbed(pkgdir string, patterns []string) (files []string, pmap map[string][]string, err error) {
-	var pattern string
-	defer func() {
+// patterns to files. A pattern with the all: prefix also matches
+// files beginning with '.' or '_' in the directories it walks;
+// its pmap entry is keyed by the original pattern.
+// If conf.AllErrors is set, resolveEmbed keeps going after a failing
+// pattern and returns an ErrorList along with the files matched
+// by the other patterns; otherwise it returns an *EmbedError.
+func resolveEmbed(conf *Resolver, pkgdir string, patterns []string) (files []string, pmap map[string][]string, err error) {
+	// The messages have no position information; callers that know
+	// the pattern positions set EmbedError.Pos.
+	r, err := conf.newResolver(pkgdir)
+	if err != nil {
+		return nil, nil, err
+	}
+	allErrors := conf.AllErrors
+	pmap = make(map[string][]string)
+	var errs ErrorList
+	for _, pattern := range patterns {
+		r.pid++
+		list, err := r.resolvePattern(pattern)
 		if err != nil {
-			err = &EmbedError{
-				Pattern: pattern,
-				Err:     err,
+			if !allErrors {
+				return nil, nil, &EmbedError{Pattern: pattern, Err: err}
 			}
+			errs = append(errs, &EmbedError{Pattern: pattern, Err: err})
+			continue
 		}
-	}()
+		pmap[pattern] = list
+	}
 
-	// TODO(rsc): All these messages need position information for better error reports.
-	pmap = make(map[string][]string)
-	have := make(map[string]int)
-	dirOK := make(map[string]bool)
-	pid := 0 // pattern ID, to allow reuse of have map
-	for _, pattern = range patterns {
-		pid++
-
-		// Check pattern is valid for //go:embed.
-		if _, err := path.Match(pattern, ""); err != nil || !validEmbedPattern(pattern) {
-			return nil, nil, fmt.Errorf("invalid pattern syntax")
+	have := make(map[string]bool)
+	for _, list := range pmap {
+		for _, file := range list {
+			if !have[file] {
+				have[file] = true
+				files = append(files, file)
+			}
 		}
+	}
+	sort.Strings(files)
+	if len(errs) > 0 {
+		return files, pmap, errs
+	}
+	return files, pmap, nil
+}
 
-		// Glob to find matches.
-		match, err := fsys.Glob(pkgdir + string(filepath.Separator) + filepath.FromSlash(pattern))
-		if err != nil {
-			return nil, nil, err
+type resolver struct {
+	fsys   FileSystem
+	pkgdir string
+	have   map[string]int
+	dirOK  map[string]bool
+	pid    int // pattern ID, to allow reuse of have map
+	minor  int // Go 1 minor version of the patterns, or -1 for any
+	visit  func(dir string)
+
+	// explain, if set, is called for every candidate path and the
+	// errors of single files are reported to it instead of returned.
+	explain func(c Candidate)
+}
+
+// include records that rel is embedded for reason
+func (r *resolver) include(rel, reason string) {
+	if r.explain != nil {
+		r.explain(Candidate{Path: rel, Included: true, Reason: reason})
+	}
+}
+
+// exclude records that rel is skipped for reason
+func (r *resolver) exclude(rel, reason string) {
+	if r.explain != nil {
+		r.explain(Candidate{Path: rel, Reason: reason})
+	}
+}
+
+// fail returns err, or records it as the reason rel is skipped in
+// explain mode and returns nil.
+func (r *resolver) fail(rel string, err error) error {
+	if r.explain == nil {
+		return err
+	}
+	r.exclude(rel, err.Error())
+	return nil
+}
+
+// rel returns path relative to the package directory, slash-separated.
+func (r *resolver) rel(path string) string {
+	if r.pkgdir == "." {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(path[len(r.pkgdir)+1:])
+}
+
+// resolvePattern resolves a single //go:embed pattern to a sorted file list.
+func (r *resolver) resolvePattern(pattern string) ([]string, error) {
+	glob := pattern
+	all := strings.HasPrefix(pattern, "all:")
+	if all {
+		if r.minor >= 0 && r.minor < 18 {
+			return nil, fmt.Errorf("all: prefix requires go1.18 or later (-lang was set to go1.%d; check go.mod)", r.minor)
 		}
+		glob = pattern[len("all:"):]
+	}
+	// Check pattern is valid for //go:embed.
+	if _, err := path.Match(glob, ""); err != nil || !validEmbedPattern(glob) {
+		return nil, fmt.Errorf("invalid pattern syntax")
+	}
 
-		// Filter list of matches down to the ones that will still exist when
-		// the directory is packaged up as a module. (If p.Dir is in the module cache,
-		// only those files exist already, but if p.Dir is in the current module,
-		// then there may be other things lying around, like symbolic links or .git directories.)
-		var list []string
-		for _, file := range match {
-			rel := filepath.ToSlash(file[len(pkgdir)+1:]) // file, relative to p.Dir
+	// Glob to find matches.
+	match, err := r.fsys.Glob(filepath.Join(r.pkgdir, filepath.FromSlash(glob)))
+	if err != nil {
+		return nil, err
+	}
 
-			what := "file"
-			info, err := fsys.Lstat(file)
-			if err != nil {
-				return nil, nil, err
-			}
-			if info.IsDir() {
-				what = "directory"
+	// Filter list of matches down to the ones that will still exist when
+	// the directory is packaged up as a module. (If p.Dir is in the module cache,
+	// only those files exist already, but if p.Dir is in the current module,
+	// then there may be other things lying around, like symbolic links or .git directories.)
+	var list []string
+	for _, file := range match {
+		rel := r.rel(file) // file, relative to p.Dir
+		if err := r.checkMatch(file, rel); err != nil {
+			if err = r.fail(rel, err); err != nil {
+				return nil, err
 			}
+			continue
+		}
+		info, err := r.fsys.Lstat(file)
+		if err != nil {
+			return nil, err
+		}
 
-			// Check that directories along path do not begin a new module
-			// (do not contain a go.mod).
-			for dir := file; len(dir) > len(pkgdir)+1 && !dirOK[dir]; dir = filepath.Dir(dir) {
-				if _, err := fsys.Stat(filepath.Join(dir, "go.mod")); err == nil {
-					return nil, nil, fmt.Errorf("cannot embed %s %s: in different module", what, rel)
-				}
-				if dir != file {
-					if info, err := fsys.Lstat(dir); err == nil && !info.IsDir() {
-						return nil, nil, fmt.Errorf("cannot embed %s %s: in non-directory %s", what, rel, dir[len(pkgdir)+1:])
-					}
-				}
-				dirOK[dir] = true
-				if elem := filepath.Base(dir); isBadEmbedName(elem) {
-					if dir == file {
-						return nil, nil, fmt.Errorf("cannot embed %s %s: invalid name %s", what, rel, elem)
-					} else {
-						return nil, nil, fmt.Errorf("cannot embed %s %s: in invalid directory %s", what, rel, elem)
-					}
-				}
+		switch {
+		default:
+			if err := r.fail(rel, fmt.Errorf("cannot embed irregular file %s", rel)); err != nil {
+				return nil, err
 			}
 
-			switch {
-			default:
-				return nil, nil, fmt.Errorf("cannot embed irregular file %s", rel)
+		case info.Mode().IsRegular():
+			if r.have[rel] != r.pid {
+				r.have[rel] = r.pid
+				list = append(list, rel)
+				r.include(rel, "matched by pattern")
+			}
 
-			case info.Mode().IsRegular():
-				if have[rel] != pid {
-					have[rel] = pid
-					list = append(list, rel)
+		case info.IsDir():
+			// Gather all files in the named directory, stopping at module boundaries
+			// and ignoring files that wouldn't be packaged into a module.
+			count := 0
+			err := r.fsys.Walk(file, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
 				}
-
-			case info.IsDir():
-				// Gather all files in the named directory, stopping at module boundaries
-				// and ignoring files that wouldn't be packaged into a module.
-				count := 0
-				err := fsys.Walk(file, func(path string, info os.FileInfo, err error) error {
-					if err != nil {
-						return err
-					}
-					rel := filepath.ToSlash(path[len(pkgdir)+1:])
-					name := info.Name()
-					if path != file && (isBadEmbedName(name) || name[0] == '.' || name[0] == '_') {
-						// Ignore bad names, assuming they won't go into modules.
-						// Also avoid hidden files that user may not know about.
-						// See golang.org/issue/42328.
-						if info.IsDir() {
-							return fs.SkipDir
-						}
-						return nil
+				rel := r.rel(path)
+				name := info.Name()
+				if path != file && (isBadEmbedName(name) || ((name[0] == '.' || name[0] == '_') && !all)) {
+					// Ignore bad names, assuming they won't go into modules.
+					// Also avoid hidden files that user may not know about,
+					// unless the pattern has the all: prefix.
+					// See golang.org/issue/42328 and golang.org/issue/43854.
+					switch {
+					case name == "":
+						r.exclude(rel, "empty name")
+					case isBadEmbedName(name):
+						r.exclude(rel, "version control directory")
+					default:
+						r.exclude(rel, "hidden name begins with . or _, use the all: prefix to embed it")
 					}
 					if info.IsDir() {
-						if _, err := fsys.Stat(filepath.Join(path, "go.mod")); err == nil {
-							return filepath.SkipDir
-						}
-						return nil
+						return fs.SkipDir
 					}
-					if !info.Mode().IsRegular() {
-						return nil
+					return nil
+				}
+				if info.IsDir() {
+					if _, err := r.fsys.Stat(filepath.Join(path, "go.mod")); err == nil {
+						r.exclude(rel, "directory in different module, contains go.mod")
+						return filepath.SkipDir
 					}
-					count++
-					if have[rel] != pid {
-						have[rel] = pid
-						list = append(list, rel)
+					if r.visit != nil {
+						r.visit(path)
 					}
 					return nil
-				})
-				if err != nil {
-					return nil, nil, err
 				}
-				if count == 0 {
-					return nil, nil, fmt.Errorf("cannot embed directory %s: contains no embeddable files", rel)
+				if !info.Mode().IsRegular() {
+					if info.Mode()&os.ModeSymlink != 0 {
+						r.exclude(rel, "symbolic link")
+					} else {
+						r.exclude(rel, "irregular file")
+					}
+					return nil
+				}
+				count++
+				if r.have[rel] != r.pid {
+					r.have[rel] = r.pid
+					list = append(list, rel)
+					r.include(rel, "in directory "+r.rel(file))
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			if count == 0 {
+				if err := r.fail(rel, fmt.Errorf("cannot embed directory %s: contains no embeddable files", rel)); err != nil {
+					return nil, err
 				}
 			}
 		}
+	}
+
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no matching files found")
+	}
+	sort.Strings(list)
+	return list, nil
+}
 
-		if len(list) == 0 {
-			return nil, nil, fmt.Errorf("no matching files found")
+// checkMatch checks that the file matched by the glob, or a directory
+// along its path, is not in a different module or has a bad name.
+func (r *resolver) checkMatch(file, rel string) error {
+	what := "file"
+	info, err := r.fsys.Lstat(file)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		what = "directory"
+	}
+
+	// Check that directories along path do not begin a new module
+	// (do not contain a go.mod).
+	for dir := file; r.inPkgDir(dir) && !r.dirOK[dir]; dir = filepath.Dir(dir) {
+		if _, err := r.fsys.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return fmt.Errorf("cannot embed %s %s: in different module", what, rel)
+		}
+		if dir != file {
+			if info, err := r.fsys.Lstat(dir); err == nil && !info.IsDir() {
+				return fmt.Errorf("cannot embed %s %s: in non-directory %s", what, rel, r.rel(dir))
+			}
+		}
+		r.dirOK[dir] = true
+		if elem := filepath.Base(dir); isBadEmbedName(elem) {
+			if dir == file {
+				return fmt.Errorf("cannot embed %s %s: invalid name %s", what, rel, elem)
+			} else {
+				return fmt.Errorf("cannot embed %s %s: in invalid directory %s", what, rel, elem)
+			}
 		}
-		sort.Strings(list)
-		pmap[pattern] = list
 	}
+	return nil
+}
 
-	for file := range have {
-		files = append(files, file)
+// inPkgDir reports whether dir is below the package directory
+func (r *resolver) inPkgDir(dir string) bool {
+	if dir == r.pkgdir {
+		return false
 	}
-	sort.Strings(files)
-	return files, pmap, nil
+	if r.pkgdir == "." {
+		return !filepath.IsAbs(dir) && dir != ".." && !strings.HasPrefix(dir, ".."+string(filepath.Separator))
+	}
+	prefix := r.pkgdir
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+	return strings.HasPrefix(dir, prefix)
 }
 
 func validEmbedPattern(pattern string) bool {
@@ -199,7 +402,21 @@ func isBadEmbedName(name string) bool {
 	return false
 }
 
+// ToEmbedCfg returns the -embedcfg file content for go tool compile.
+// The files are mapped to their paths in dir, or to their replacement
+// paths if they are overlaid by fsys.
 func ToEmbedCfg(dir string, files []string, pmap map[string][]string) ([]byte, error) {
+	var r Resolver
+	return r.ToEmbedCfg(dir, files, pmap)
+}
+
+// ToEmbedCfg is like the ToEmbedCfg function but maps the files to
+// their paths on disk in r.FS, see DiskPath.
+func (r *Resolver) ToEmbedCfg(dir string, files []string, pmap map[string][]string) ([]byte, error) {
+	fsys := r.FS
+	if fsys == nil {
+		fsys = OS
+	}
 	var embedcfg []byte
 	if len(pmap) > 0 {
 		var embed struct {
@@ -209,7 +426,11 @@ func ToEmbedCfg(dir string, files []string, pmap map[string][]string) ([]byte, e
 		embed.Patterns = pmap
 		embed.Files = make(map[string]string)
 		for _, file := range files {
-			embed.Files[file] = filepath.Join(dir, file)
+			p, err := DiskPath(fsys, filepath.Join(dir, file))
+			if err != nil {
+				return nil, err
+			}
+			embed.Files[file] = p
 		}
 		js, err := json.MarshalIndent(&embed, "", "\t")
 		if err != nil {
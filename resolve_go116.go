@@ -0,0 +1,16 @@
+//go:build go1.16
+// +build go1.16
+
+package goembed
+
+import (
+	iofs "io/fs"
+
+	"github.com/visualfc/goembed/resolve"
+)
+
+// WithFS resolves and reads the embed files from fsys instead of the
+// OS file system. The dir passed to Resolve and Load is a path in fsys.
+func WithFS(fsys iofs.FS) ResolveOption {
+	return WithFileSystem(resolve.FromFS(fsys))
+}
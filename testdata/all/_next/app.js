@@ -0,0 +1 @@
+hello next
\ No newline at end of file
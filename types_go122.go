@@ -0,0 +1,10 @@
+//go:build go1.22
+// +build go1.22
+
+package goembed
+
+import "go/types"
+
+func unalias(typ types.Type) types.Type {
+	return types.Unalias(typ)
+}
@@ -0,0 +1,320 @@
+package goembed
+
+import (
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WatchOptions controls NewWatcher
+type WatchOptions struct {
+	Poll           bool            // poll for changes instead of using file system notifications
+	Interval       time.Duration   // poll interval, zero is one second
+	Debounce       time.Duration   // delay to coalesce changes before rescanning, zero is 100ms
+	ResolveOptions []ResolveOption // options of the resolve used to load the files
+}
+
+// WatchEvent describes the go:embed vars changed on disk
+type WatchEvent struct {
+	Embeds []*Embed // vars whose file set or file contents changed
+	Err    error    // errors resolving or loading the vars, if any
+}
+
+// Watcher watches the files of go:embed vars and reloads the vars
+// whose files changed. Files not changed are reused from the cache.
+type Watcher struct {
+	Events <-chan *WatchEvent
+
+	dir      string
+	fset     *token.FileSet
+	ems      []*Embed
+	r        *resolveFile
+	interval time.Duration
+	debounce time.Duration
+
+	mu     sync.Mutex
+	state  map[*Embed]*watchState
+	errMsg string
+
+	events  chan *WatchEvent
+	done    chan struct{}
+	changed chan struct{}
+	notify  notifier
+	wg      sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// watchState is the loaded files of a go:embed var
+type watchState struct {
+	files  []*File
+	stamps map[string]fileStamp
+	dirs   []string
+	err    error
+}
+
+// fileStamp identifies a version of a file on disk
+type fileStamp struct {
+	size  int64
+	mtime time.Time
+}
+
+// notifier reports changes in the watched directories
+type notifier interface {
+	watch(dirs []string)
+	close() error
+}
+
+// NewWatcher loads the files of ems in dir and watches them for changes.
+// A nil opts uses the default options. The changes are sent to Events
+// until Close is called.
+func NewWatcher(dir string, fset *token.FileSet, ems []*Embed, opts *WatchOptions) (*Watcher, error) {
+	if opts == nil {
+		opts = &WatchOptions{}
+	}
+	w := &Watcher{
+		dir:      filepath.Clean(dir),
+		fset:     fset,
+		ems:      ems,
+		r:        NewResolve(opts.ResolveOptions...).(*resolveFile),
+		interval: opts.Interval,
+		debounce: opts.Debounce,
+		state:    make(map[*Embed]*watchState),
+		events:   make(chan *WatchEvent),
+		done:     make(chan struct{}),
+		changed:  make(chan struct{}, 1),
+	}
+	if w.interval <= 0 {
+		w.interval = time.Second
+	}
+	if w.debounce <= 0 {
+		w.debounce = 100 * time.Millisecond
+	}
+	w.Events = w.events
+	for _, em := range ems {
+		st := w.load(em)
+		if st.err != nil {
+			return nil, st.err
+		}
+		w.state[em] = st
+	}
+	if !opts.Poll {
+		if n, err := newNotifier(w.changed); err == nil {
+			w.notify = n
+			n.watch(w.watchDirs())
+		}
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// Files returns the current files of em
+func (w *Watcher) Files(em *Embed) []*File {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if st, ok := w.state[em]; ok {
+		return st.files
+	}
+	return nil
+}
+
+// Close stops watching and closes Events. It is safe to call Close
+// more than once or concurrently, the later calls return the error of
+// the first one.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		if w.notify != nil {
+			w.closeErr = w.notify.close()
+		}
+		w.wg.Wait()
+		close(w.events)
+	})
+	return w.closeErr
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+	var tick <-chan time.Time
+	if w.notify == nil {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var timer *time.Timer
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-w.changed:
+			if timer == nil {
+				timer = time.NewTimer(w.debounce)
+			} else {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(w.debounce)
+			}
+			fire = timer.C
+		case <-fire:
+			fire = nil
+			w.rescan()
+		case <-tick:
+			w.rescan()
+		}
+	}
+}
+
+// rescan reloads the changed vars and sends their event
+func (w *Watcher) rescan() {
+	var changed []*Embed
+	var errs []error
+	for _, em := range w.ems {
+		w.mu.Lock()
+		old := w.state[em]
+		w.mu.Unlock()
+		w.invalidate(old)
+		st := w.load(em)
+		if st.err != nil {
+			errs = append(errs, st.err)
+		}
+		if !w.sameFiles(old, st) {
+			changed = append(changed, em)
+		}
+		w.mu.Lock()
+		w.state[em] = st
+		w.mu.Unlock()
+	}
+	if w.notify != nil {
+		w.notify.watch(w.watchDirs())
+	}
+	var err error
+	var msg string
+	if len(errs) > 0 {
+		list := appendError(nil, errs[0])
+		for _, e := range errs[1:] {
+			list = appendError(list, e)
+		}
+		list.Sort()
+		err, msg = list, list.Error()
+	}
+	if len(changed) == 0 && msg == w.errMsg {
+		return
+	}
+	w.errMsg = msg
+	select {
+	case w.events <- &WatchEvent{Embeds: changed, Err: err}:
+	case <-w.done:
+	}
+}
+
+// invalidate removes the files of st changed on disk from the cache
+func (w *Watcher) invalidate(st *watchState) {
+	for name, stamp := range st.stamps {
+		fpath := filepath.Join(w.dir, name)
+		if cur, ok := w.stamp(fpath); ok && cur == stamp {
+			continue
+		}
+		w.r.mu.Lock()
+		delete(w.r.data, fpath)
+		w.r.mu.Unlock()
+	}
+}
+
+// load loads the files of em with their stamps and directories.
+// The directories are the ones walked by the patterns, the parents
+// of the files and the literal directories of the patterns.
+func (w *Watcher) load(em *Embed) *watchState {
+	st := &watchState{stamps: make(map[string]fileStamp)}
+	dirs := map[string]bool{w.dir: true}
+	st.files, st.err = w.r.load(w.dir, w.fset, em, func(dir string) {
+		dirs[dir] = true
+	})
+	for _, f := range st.files {
+		fpath := filepath.Join(w.dir, filepath.FromSlash(f.Name))
+		if stamp, ok := w.stamp(fpath); ok {
+			st.stamps[f.Name] = stamp
+		}
+		for dir := filepath.Dir(fpath); len(dir) > len(w.dir) && !dirs[dir]; dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	for _, pattern := range em.Patterns {
+		glob := filepath.Join(w.dir, filepath.FromSlash(strings.TrimPrefix(pattern, "all:")))
+		if dir := filepath.Dir(glob); !hasMeta(dir) {
+			dirs[dir] = true
+		}
+	}
+	for dir := range dirs {
+		st.dirs = append(st.dirs, dir)
+	}
+	sort.Strings(st.dirs)
+	return st
+}
+
+// stamp returns the stamp of the file fpath
+func (w *Watcher) stamp(fpath string) (fileStamp, bool) {
+	info, err := w.r.fsys.Stat(fpath)
+	if err != nil {
+		return fileStamp{}, false
+	}
+	return fileStamp{info.Size(), info.ModTime()}, true
+}
+
+// watchDirs returns the directories of all vars
+func (w *Watcher) watchDirs() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	have := make(map[string]bool)
+	var dirs []string
+	for _, st := range w.state {
+		for _, dir := range st.dirs {
+			if !have[dir] {
+				have[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// sameFiles reports whether the files of x and y have the same names
+// and contents. Without hashes, the contents are compared by stamps.
+func (w *Watcher) sameFiles(x, y *watchState) bool {
+	if len(x.files) != len(y.files) || len(x.stamps) != len(y.stamps) {
+		return false
+	}
+	for i, f := range x.files {
+		g := y.files[i]
+		if f.Name != g.Name || f.Size != g.Size || f.Hash != g.Hash {
+			return false
+		}
+	}
+	if w.r.hash == HashNone {
+		for name, stamp := range x.stamps {
+			if y.stamps[name] != stamp {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hasMeta reports whether path contains any of the magic characters
+// recognized by filepath.Match.
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
@@ -0,0 +1,78 @@
+package goembed
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY |
+	syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB | syscall.IN_MOVED_FROM |
+	syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// inotify is the notifier using the Linux inotify API
+type inotify struct {
+	fd      int
+	file    *os.File
+	changed chan<- struct{}
+
+	mu  sync.Mutex
+	wds map[string]int // dir -> watch descriptor
+}
+
+// newNotifier returns a notifier sending to changed on changes
+func newNotifier(changed chan<- struct{}) (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	n := &inotify{
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		changed: changed,
+		wds:     make(map[string]int),
+	}
+	go n.read()
+	return n, nil
+}
+
+// read signals changed for the events until the file is closed
+func (n *inotify) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		if _, err := n.file.Read(buf); err != nil {
+			return
+		}
+		select {
+		case n.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watch sets the watched directories to dirs
+func (n *inotify) watch(dirs []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	have := make(map[string]bool)
+	for _, dir := range dirs {
+		have[dir] = true
+		if _, ok := n.wds[dir]; ok {
+			continue
+		}
+		wd, err := syscall.InotifyAddWatch(n.fd, dir, inotifyMask)
+		if err == nil {
+			n.wds[dir] = wd
+		}
+	}
+	for dir, wd := range n.wds {
+		if !have[dir] {
+			syscall.InotifyRmWatch(n.fd, uint32(wd))
+			delete(n.wds, dir)
+		}
+	}
+}
+
+func (n *inotify) close() error {
+	return n.file.Close()
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package goembed
+
+import (
+	"errors"
+)
+
+// newNotifier returns an error, the Watcher polls for changes
+func newNotifier(changed chan<- struct{}) (notifier, error) {
+	return nil, errors.New("file system notifications not supported")
+}